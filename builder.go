@@ -4,9 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type countModel struct {
@@ -21,34 +22,82 @@ type whereConstraint struct {
 	isOr            bool
 	extCharPosition int //0 : 无 1 : group_start 2 : group_end
 	extChar         int
+	operand         string //不为空时替代?占位符,如列与列比较时的列名
+}
+
+// where条件中允许使用的比较符
+var whereSymbols = map[string]bool{"=": true, "<": true, ">": true, "<=": true, ">=": true, "<>": true, "!=": true}
+
+// 表及其别名
+type tableModel struct {
+	sql  string //添加限定符后的表名及别名
+	ref  string //引用该表时使用的名称,即别名或表名
+	name string //不包含数据库名及别名的表名,子查询时为空
 }
 
 type joinModel struct {
-	table     string
-	condition string
-	joinType  string
+	table       string
+	ref         string //引用该表时使用的名称
+	name        string //不包含数据库名及别名的表名,子查询时为空
+	condition   string //on条件,不包含on
+	using       string
+	joinType    string
+	tableParams []interface{} //子查询的参数
+	params      []interface{} //on条件的参数
+}
+
+// 与其他查询的组合,如union
+type unionModel struct {
+	op     string
+	sql    string
+	params []interface{}
+}
+
+// 公用表表达式(with)
+type cteModel struct {
+	name      string
+	sql       string
+	params    []interface{}
+	recursive bool
 }
 
 type setModel struct {
 	column string
 	value  interface{}
+	expr   string        //不为空时使用表达式赋值
+	params []interface{} //表达式中的参数
+	field  string        //由SetModel设置时为字段对应的列名,受Only及Omit限制
 }
 
 type builder struct {
-	from           []string
-	columns        []string
-	join           []joinModel
-	groupby        []string
-	having         []string
-	whereCondition []whereConstraint
-	distinct       bool
-	limit          int
-	offset         int
-	orderby        []string
-	groupStart     int
-	groupEnd       int
-	set            []setModel
-	db             *DB
+	from         []tableModel
+	columns      []string
+	join         []joinModel
+	groupby      []string
+	having       []string
+	condition    Cond
+	distinct     bool
+	limit        int
+	offset       int
+	orderby      []string
+	set          []setModel
+	unions       []unionModel
+	ctes         []cteModel
+	windows      []string
+	lock         string
+	lockWait     string
+	fullTable    bool
+	returning    []string
+	withTrashed  bool
+	forceDelete  bool
+	preloads     []string
+	only         map[string]bool //Only设置的列,为空时不限制
+	omit         map[string]bool //Omit设置的列
+	columnParams []interface{}
+	orderParams  []interface{}
+	err          error
+	lastErr      error
+	db           *DB
 }
 
 // Begin 开始一个事务,在调用Commit或者Rollback之前的所有sql操作会被绑定在同一个数据库连接
@@ -74,35 +123,129 @@ func (this *builder) reset() {
 	this.orderby = this.orderby[:0]
 	this.offset = 0
 	this.limit = 0
-	this.groupStart = 0
-	this.groupEnd = 0
 	this.distinct = false
-	this.whereCondition = make([]whereConstraint, 0, 0)
+	this.columnParams = nil
+	this.orderParams = nil
+	this.err = nil
+	this.condition = newCond(this.db.dialect)
 	this.join = make([]joinModel, 0, 0)
 	this.set = make([]setModel, 0, 0)
+	this.unions = nil
+	this.ctes = nil
+	this.windows = nil
+	this.lock = ""
+	this.lockWait = ""
+	this.fullTable = false
+	this.returning = nil
+	this.only = nil
+	this.omit = nil
+	this.withTrashed = false
+	this.forceDelete = false
+	this.preloads = nil
 }
 
+// OrderBy 支持逗号分隔的多个排序表达式,如 name desc,field(status,1,2)
+//  警告:表达式中的函数调用原样输出,column绝不能来自外部输入(如url参数),
+//  否则可以通过 if(ascii(substring(current_user(),1,1))>100,id,name) 等表达式进行盲注,外部输入使用OrderBySafe
 func (this *builder) OrderBy(column string) *builder {
 	if strings.Trim(column, " ") == "" {
 		return this
 	}
-	var cols = strings.Split(column, ",")
+	var cols = splitExpr(column)
 	for i := 0; i < len(cols); i++ {
-		cols[i] = addDelimiter(cols[i], 3)
+		var col, err = parseExpr(this.db.dialect, cols[i], exprOrder)
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+		cols[i] = col
 	}
 	this.orderby = append(this.orderby, cols...)
 	return this
 }
 
-// toSql 生成sql语句
+// OrderBySafe 使用外部输入(如url参数)排序,只有allowed中列出的列可以被使用
+//  input:逗号分隔的排序列,列后可以跟asc/desc,也可以使用-前缀表示倒序,如 -created_at,name asc
+//  allowed:允许排序的列
+func (this *builder) OrderBySafe(input string, allowed ...string) *builder {
+	if strings.Trim(input, " ") == "" {
+		return this
+	}
+	var items = strings.Split(input, ",")
+	for i := 0; i < len(items); i++ {
+		var fields = strings.Fields(items[i])
+		var col, dir = "", "asc"
+		switch len(fields) {
+		case 1:
+			col = fields[0]
+			if strings.HasPrefix(col, "-") {
+				col, dir = col[1:], "desc"
+			}
+		case 2:
+			col, dir = fields[0], strings.ToLower(fields[1])
+		}
+		if col == "" || (dir != "asc" && dir != "desc") {
+			this.setError(TinySqlErrorColumnNotAllowedError.Format(items[i]).Error())
+			return this
+		}
+		var ok = false
+		for _, a := range allowed {
+			if a == col {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			this.setError(TinySqlErrorColumnNotAllowedError.Format(col).Error())
+			return this
+		}
+		var c, err = parseExpr(this.db.dialect, col, exprColumn)
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+		this.orderby = append(this.orderby, c+" "+dir)
+	}
+	return this
+}
+
+// OrderByRaw 添加原样输出的排序表达式,表达式中可以使用?占位符
+func (this *builder) OrderByRaw(expr string, args ...interface{}) *builder {
+	this.orderby = append(this.orderby, expr)
+	this.orderParams = append(this.orderParams, args...)
+	return this
+}
+
+// setError 记录构造sql时产生的第一个错误
+func (this *builder) setError(err error) {
+	if this.err == nil {
+		this.err = err
+	}
+}
+
+// Error 返回最近一次执行产生的错误
+func (this *builder) Error() error {
+	return this.lastErr
+}
+
+// toQuerySql 生成sql语句,with位于整个语句之前,作用于union组合后的查询
 func (this *builder) toQuerySql() (string, []interface{}) {
+	var sql, params = this.selectSql()
+	if sql == "" {
+		return "", nil
+	}
+	var with, withParams = this.withSql()
+	return with + sql, append(withParams, params...)
+}
+
+// selectSql 生成不包含with的查询语句
+func (this *builder) selectSql() (string, []interface{}) {
 	if len(this.from) == 0 {
 		return "", nil
 	}
-	var sql string
 	var params = make([]interface{}, 0, 0)
 	//select
-	sql = "select "
+	var sql = "select "
 	if this.distinct {
 		sql += " distinct "
 	}
@@ -113,69 +256,35 @@ func (this *builder) toQuerySql() (string, []interface{}) {
 			sql += (this.columns[i] + ",")
 		}
 		sql = sql[:len(sql)-1]
+		params = append(params, this.columnParams...)
 	}
 	// from
 	sql += " from "
 	for i := 0; i < len(this.from); i++ {
-		sql += (this.from[i] + ",")
+		sql += (this.from[i].sql + ",")
 	}
 	sql = sql[:len(sql)-1]
 	//join
-	if len(this.join) != 0 {
-		for i := 0; i < len(this.join); i++ {
-			sql += this.join[i].joinType
-			sql += " join "
-			sql += this.join[i].table
-			sql += " on "
-			sql += this.join[i].condition
-		}
-	}
+	var joins, joinParams = this.joinSql(this.join)
+	sql += joins
+	params = append(params, joinParams...)
 	//group by
 
 	// where
-	if len(this.whereCondition) != 0 {
-		sql += " where "
-		isFirst := true
-		for i := 0; i < len(this.whereCondition); i++ {
-			var v = this.whereCondition[i]
-			//where group
-			if v.extCharPosition == 1 {
-				sql += " "
-				sql += strings.Repeat("(", v.extChar)
-			}
-			if v.isOr {
-				if !isFirst {
-					sql += " or "
-				} else {
-					isFirst = false
-				}
-
-			} else {
-				if !isFirst {
-					sql += " and "
-				} else {
-					isFirst = false
-				}
-			}
-			if v.multiValue {
-				sql += (v.column + " in (")
-				sql += strings.Repeat("?,", len(v.values))
-				sql = sql[:len(sql)-1]
-				sql += (") ")
-				params = append(params, v.values...)
-			} else {
-				sql += (v.column + "? ")
-				params = append(params, v.value)
-			}
-			// where group
-			if v.extCharPosition == 2 {
-				sql += " "
-				sql += strings.Repeat(")", v.extChar)
-			}
-		}
+	var where, whereParams = this.whereSql(this.trashedSql(this.from), nil)
+	sql += where
+	params = append(params, whereParams...)
+	//window
+	if len(this.windows) != 0 {
+		sql += " window " + strings.Join(this.windows, ",")
 	}
-	if this.groupEnd != 0 {
-		sql += strings.Repeat(")", this.groupEnd)
+	//union,order by及limit作用于组合后的结果
+	if len(this.unions) != 0 {
+		sql = this.db.dialect.compound(sql)
+		for i := 0; i < len(this.unions); i++ {
+			sql += " " + this.unions[i].op + " " + this.db.dialect.compound(this.unions[i].sql)
+			params = append(params, this.unions[i].params...)
+		}
 	}
 	//order by
 	if len(this.orderby) != 0 {
@@ -184,211 +293,896 @@ func (this *builder) toQuerySql() (string, []interface{}) {
 			sql += this.orderby[i] + ","
 		}
 		sql = sql[:len(sql)-1]
+		params = append(params, this.orderParams...)
 	}
 	//limit
 	if this.limit != 0 {
-		sql += " limit "
-		sql += strconv.Itoa(this.offset)
-		sql += ","
-		sql += strconv.Itoa(this.limit)
+		sql += this.db.dialect.limit(this.limit, this.offset, len(this.orderby) != 0)
+	}
+	//lock
+	if this.lock != "" {
+		sql += " " + this.lock
+		if this.lockWait != "" {
+			sql += " " + this.lockWait
+		}
 	}
-	fmt.Println("[TinySql]", sql)
 	return sql, params
 }
 
+// Union 与other的结果合并并去重,当前查询的OrderBy及Limit作用于合并后的结果
+func (this *builder) Union(other *builder) *builder {
+	return this.addUnion("union", other)
+}
+
+// UnionAll 与other的结果合并,不去重
+func (this *builder) UnionAll(other *builder) *builder {
+	return this.addUnion("union all", other)
+}
+
+// Intersect 与other的结果取交集,mysql不支持
+func (this *builder) Intersect(other *builder) *builder {
+	if !this.db.dialect.intersect {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "intersect").Error())
+		return this
+	}
+	return this.addUnion("intersect", other)
+}
+
+// Except 与other的结果取差集,mysql不支持
+func (this *builder) Except(other *builder) *builder {
+	if !this.db.dialect.intersect {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "except").Error())
+		return this
+	}
+	return this.addUnion("except", other)
+}
+
+// With 添加公用表表达式,之后可以在From及Join中通过name引用
+func (this *builder) With(name string, sub *builder) *builder {
+	return this.addCte(name, nil, sub, nil)
+}
+
+// WithRecursive 添加递归公用表表达式
+//  columns:公用表的列名
+//  anchor:初始查询
+//  recursive:引用name的递归查询,与anchor以union all合并
+func (this *builder) WithRecursive(name string, columns []string, anchor *builder, recursive *builder) *builder {
+	return this.addCte(name, columns, anchor, recursive)
+}
+
+func (this *builder) addCte(name string, columns []string, anchor *builder, recursive *builder) *builder {
+	var n, err = parseExpr(this.db.dialect, name, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	if len(columns) != 0 {
+		var cols = make([]string, len(columns))
+		for i := 0; i < len(columns); i++ {
+			cols[i], err = parseExpr(this.db.dialect, columns[i], exprColumn)
+			if err != nil {
+				this.setError(err)
+				return this
+			}
+		}
+		n += " (" + strings.Join(cols, ",") + ")"
+	}
+	var parts = []*builder{anchor}
+	if recursive != nil {
+		parts = append(parts, recursive)
+	}
+	var cte = cteModel{name: n, recursive: recursive != nil}
+	for i, part := range parts {
+		if part.err != nil {
+			this.setError(part.err)
+			return this
+		}
+		var sql, params = part.toQuerySql()
+		if sql == "" {
+			this.setError(TinySqlErrorParamInvalidError.Format("with " + name).Error())
+			return this
+		}
+		if i != 0 {
+			cte.sql += " union all "
+		}
+		cte.sql += sql
+		cte.params = append(cte.params, params...)
+	}
+	this.ctes = append(this.ctes, cte)
+	return this
+}
+
+// withSql 生成with语句,作为select,update及delete的前缀
+func (this *builder) withSql() (string, []interface{}) {
+	var params = make([]interface{}, 0, 0)
+	if len(this.ctes) == 0 {
+		return "", params
+	}
+	var sql = "with "
+	for i := 0; i < len(this.ctes); i++ {
+		if this.ctes[i].recursive && this.db.dialect.recursive != "" {
+			sql = "with " + this.db.dialect.recursive + " "
+		}
+	}
+	for i := 0; i < len(this.ctes); i++ {
+		if i != 0 {
+			sql += ","
+		}
+		sql += this.ctes[i].name + " as (" + this.ctes[i].sql + ")"
+		params = append(params, this.ctes[i].params...)
+	}
+	return sql + " ", params
+}
+
+func (this *builder) addUnion(op string, other *builder) *builder {
+	if other.err != nil {
+		this.setError(other.err)
+		return this
+	}
+	if other.lock != "" {
+		this.setError(TinySqlErrorParamInvalidError.Format(other.lock + " in " + op).Error())
+		return this
+	}
+	var sql, params = other.selectSql()
+	if sql == "" {
+		this.setError(TinySqlErrorParamInvalidError.Format(op).Error())
+		return this
+	}
+	//other的with移到整个语句之前
+	this.ctes = append(this.ctes, other.ctes...)
+	this.unions = append(this.unions, unionModel{op: op, sql: sql, params: params})
+	return this
+}
+
+// query 将生成的sql转换为方言对应的占位符并执行查询
+func (this *builder) query(query string, params []interface{}) *Rows {
+	query = this.db.dialect.rebind(query)
+	if this.db.conn.debug {
+		fmt.Println("[TinySql]", query)
+	}
+	return this.db.Query(query, params...)
+}
+
+// exec 将生成的sql转换为方言对应的占位符并执行
+func (this *builder) exec(query string, params []interface{}) (sql.Result, error) {
+	query = this.db.dialect.rebind(query)
+	if this.db.conn.debug {
+		fmt.Println("[TinySql]", query)
+	}
+	return this.db.Exec(query, params...)
+}
+
 // Query 执行查询
 func (this *builder) Query() *Rows {
+	if this.err == nil && this.lock != "" && this.db.autoCommit {
+		this.err = TinySqlErrorNoTransactionError.Format(this.lock).Error()
+	}
+	if this.err == nil && this.lockWait != "" && this.lock == "" {
+		this.err = TinySqlErrorParamInvalidError.Format(this.lockWait).Error()
+	}
+	if this.err == nil && this.lock != "" && len(this.unions) != 0 {
+		//锁不能作用于组合查询的结果
+		this.err = TinySqlErrorParamInvalidError.Format(this.lock + " with " + this.unions[0].op).Error()
+	}
+	if this.err != nil {
+		return this.errRows()
+	}
 	var sql, params = this.toQuerySql()
+	var preloads = this.preloads
 	this.reset()
-	return this.db.Query(sql, params...)
+	var rows = this.query(sql, params)
+	rows.preloads = preloads
+	return rows
+}
+
+// ForUpdate 为查询到的行加排他锁,只能在事务中使用,不能用于union等组合查询
+func (this *builder) ForUpdate() *builder {
+	return this.setLock("for update")
+}
+
+// ForShare 为查询到的行加共享锁,只能在事务中使用,不能用于union等组合查询
+func (this *builder) ForShare() *builder {
+	return this.setLock("for share")
+}
+
+// SkipLocked 跳过已被其他事务锁定的行,需要与ForUpdate或ForShare一起使用
+func (this *builder) SkipLocked() *builder {
+	this.lockWait = "skip locked"
+	return this
+}
+
+// NoWait 遇到已被其他事务锁定的行时立即返回错误,需要与ForUpdate或ForShare一起使用
+func (this *builder) NoWait() *builder {
+	this.lockWait = "nowait"
+	return this
+}
+
+func (this *builder) setLock(lock string) *builder {
+	if !this.db.dialect.locking {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, lock).Error())
+		return this
+	}
+	this.lock = lock
+	return this
 }
 
 // Delete 执行删除方法,返回影响行数
 func (this *builder) Delete() int {
-	var sql, params = this.toDeleteSql()
+	this.lastErr = this.err
+	if this.lastErr != nil {
+		this.reset()
+		return -1
+	}
+	var query, params, err = this.toDeleteSql()
 	this.reset()
-	var res, err = this.db.Exec(sql, params...)
 	if err != nil {
+		this.lastErr = err
+		return -1
+	}
+	var res sql.Result
+	res, err = this.exec(query, params)
+	if err != nil {
+		this.lastErr = err
 		return -1
 	}
 	var c int64
 	c, err = res.RowsAffected()
 	if err != nil {
+		this.lastErr = err
 		return -1
 	}
 	return int(c)
 }
 
+// ForceDelete 执行删除方法,使用软删除的表同样删除数据,返回影响行数
+//  不会删除已被软删除的行,需要同时删除时使用WithTrashed
+func (this *builder) ForceDelete() int {
+	this.forceDelete = true
+	return this.Delete()
+}
+
 // Update 执行更新方法,返回影响行数
 func (this *builder) Update(table string) int {
-	if len(this.set) == 0 || strings.Trim(table, " ") == "" {
+	this.lastErr = this.err
+	if this.lastErr != nil {
+		this.reset()
 		return -1
 	}
-	var sql = "update `" + table + "` set "
-	var params = make([]interface{}, 0, 0)
-	for i := 0; i < len(this.set); i++ {
-		sql += (this.set[i].column + "=?,")
-		params = append(params, this.set[i].value)
+	if len(this.set) == 0 || strings.Trim(table, " ") == "" {
+		return -1
 	}
-	sql = sql[:len(sql)-1]
-	if len(this.whereCondition) != 0 {
-		sql += " where "
-		var isFirst = true
-		for i := 0; i < len(this.whereCondition); i++ {
-			var v = this.whereCondition[i]
-			//where group
-			if v.extCharPosition == 1 {
-				sql += " "
-				sql += strings.Repeat("(", v.extChar)
-			}
-			if v.isOr {
-				if !isFirst {
-					sql += " or "
-				} else {
-					isFirst = false
-				}
-
-			} else {
-				if !isFirst {
-					sql += " and "
-				} else {
-					isFirst = false
-				}
-			}
-			if v.multiValue {
-				sql += (v.column + " in (")
-				sql += strings.Repeat("?,", len(v.values))
-				sql = sql[:len(sql)-1]
-				sql += (") ")
-				params = append(params, v.values...)
-			} else {
-				sql += (v.column + "? ")
-				params = append(params, v.value)
-			}
-			// where group
-			if v.extCharPosition == 2 {
-				sql += " "
-				sql += strings.Repeat(")", v.extChar)
-			}
-		}
-		if this.groupEnd != 0 {
-			sql += strings.Repeat(")", this.groupEnd)
-		}
+	var t tableModel
+	t, this.lastErr = parseTable(this.db.dialect, table)
+	if this.lastErr != nil {
+		this.reset()
+		return -1
 	}
+	var query, params, err = this.toUpdateSql(t)
 	this.reset()
-	var result, err = this.db.Exec(sql, params...)
 	if err != nil {
+		this.lastErr = err
+		return -1
+	}
+	var result sql.Result
+	result, err = this.exec(query, params)
+	if err != nil {
+		this.lastErr = err
 		return -1
 	}
 	var c int64
 	c, err = result.RowsAffected()
 	if err != nil {
+		this.lastErr = err
 		return -1
 	}
 	return int(c)
 }
 
-// InsertModel 插入数据,表名即为model struct的名称
+// InsertModel 插入数据,表名为model实现的TableName方法的返回值,或按链接的命名规则由struct的名称转换得到
 func (this *builder) InsertModel(model interface{}) int {
 	var v = reflect.TypeOf(model).Elem()
-	var table = transFieldName(v.Name())
+	var table = tableName(this.db.conn.namer(), v)
 	return this.Insert(table, model)
 }
 
-// Insert 向指定table插入数据
+// Insert 向指定table插入数据,返回自增id
+//  model中标记为pk或auto的字段(如 db:"id,pk")为空时会被设置为生成的id,
+//  支持returning的数据库通过returning获取,其他数据库使用LastInsertId,
+//  支持returning的数据库中model没有pk或auto字段时返回0
 func (this *builder) Insert(table string, model interface{}) int {
-	query := "insert into `" + table + "`"
-	value := reflect.ValueOf(model).Elem()
-	data := make(map[string]interface{})
-	mapStructToMap(value, data)
-	keys := " ("
-	values := " ("
-	params := make([]interface{}, 0, 0)
-	for k, v := range data {
-		keys += "`" + k + "`,"
-		values += "?,"
-		params = append(params, v)
-	}
-	query += keys[:len(keys)-1] + ") values"
-	query += values[:len(values)-1] + ")"
-	var result sql.Result
-	var err error
+	this.lastErr = this.err
+	if this.lastErr != nil {
+		this.reset()
+		return -1
+	}
+	var value = reflect.ValueOf(model).Elem()
+	var pk, pkName, hasPk = pkField(value, this.db.conn.namer())
+	if hasPk && this.db.dialect.returning != returningNone {
+		this.returning = []string{this.db.dialect.quote(pkName)}
+	}
+	var query, params, err = this.toInsertSql(table, []reflect.Value{value})
 	this.reset()
-	result, err = this.db.Exec(query, params...)
 	if err != nil {
+		this.lastErr = err
 		return -1
 	}
+	if hasPk && this.db.dialect.returning != returningNone {
+		_, err = this.query(query, params).Scan(pk.Addr().Interface())
+		if err != nil {
+			this.lastErr = err
+			return -1
+		}
+		return int(idOf(pk))
+	}
+	var result sql.Result
+	result, err = this.exec(query, params)
+	if err != nil {
+		this.lastErr = err
+		return -1
+	}
+	if this.db.dialect.returning != returningNone {
+		//没有pk时不使用LastInsertId,postgres及mssql的驱动不支持
+		return 0
+	}
 	var id int64
 	id, err = result.LastInsertId()
 	if err != nil {
+		this.lastErr = err
 		return -1
 	}
+	if hasPk && isZero(pk) {
+		setId(pk, id)
+	}
 	return int(id)
 }
 
+// InsertBatch 使用一条语句向指定table插入多行数据,返回插入的行数
+//  models:结构体或结构体指针的切片,列以第一个元素为准
+//  models中标记为pk或auto的字段会被设置为生成的id,postgres及sqlite3通过returning获取,mssql不设置,
+//  mysql根据LastInsertId(第一行的id)依次递增设置,要求auto_increment_increment为1,
+//  并且只在所有行的id都为零值时设置
+func (this *builder) InsertBatch(table string, models interface{}) int {
+	this.lastErr = this.err
+	if this.lastErr != nil {
+		this.reset()
+		return -1
+	}
+	var slice = reflect.Indirect(reflect.ValueOf(models))
+	if slice.Kind() != reflect.Slice || slice.Len() == 0 {
+		this.reset()
+		this.lastErr = TinySqlErrorParamInvalidError.Format(slice.Type().String()).Error()
+		return -1
+	}
+	var values = make([]reflect.Value, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		values[i] = reflect.Indirect(slice.Index(i))
+	}
+	var _, pkName, hasPk = pkField(values[0], this.db.conn.namer())
+	//mssql的output inserted不保证行的顺序,无法按位置对应,不回写
+	var returnIds = hasPk && this.db.dialect.returning == returningClause
+	if returnIds {
+		this.returning = []string{this.db.dialect.quote(pkName)}
+	}
+	var query, params, err = this.toInsertSql(table, values)
+	this.reset()
+	if err != nil {
+		this.lastErr = err
+		return -1
+	}
+	if returnIds {
+		//按插入的顺序读取生成的id
+		var pk, _, _ = pkField(values[0], this.db.conn.namer())
+		var ids = reflect.New(reflect.SliceOf(pk.Type()))
+		_, err = this.query(query, params).Scan(ids.Interface())
+		if err != nil {
+			this.lastErr = err
+			return -1
+		}
+		ids = ids.Elem()
+		for i := 0; i < ids.Len() && i < len(values); i++ {
+			pk, _, _ = pkField(values[i], this.db.conn.namer())
+			pk.Set(ids.Index(i))
+		}
+		return ids.Len()
+	}
+	var result sql.Result
+	result, err = this.exec(query, params)
+	if err != nil {
+		this.lastErr = err
+		return -1
+	}
+	var c int64
+	c, err = result.RowsAffected()
+	if err != nil {
+		this.lastErr = err
+		return -1
+	}
+	if hasPk && this.db.dialect.contiguousId {
+		//部分行带有id时生成的id不再按行连续,不回写
+		var pks = make([]reflect.Value, len(values))
+		for i := 0; i < len(values); i++ {
+			pks[i], _, _ = pkField(values[i], this.db.conn.namer())
+			if !isZero(pks[i]) {
+				return int(c)
+			}
+		}
+		var id int64
+		id, err = result.LastInsertId()
+		if err == nil && id != 0 {
+			for i := 0; i < len(pks); i++ {
+				setId(pks[i], id+int64(i))
+			}
+		}
+	}
+	return int(c)
+}
+
+// toInsertSql 生成insert语句
+//  rows:要插入的结构体,必须是同一类型
+//  标记为pk,auto,omitempty或default的字段在所有行中都为零值时不写入该列,
+//  只在部分行中为零值时这些行使用default关键字
+func (this *builder) toInsertSql(table string, rows []reflect.Value) (string, []interface{}, error) {
+	var d = this.db.dialect
+	var t, err = parseExpr(d, table, exprColumn)
+	if err != nil {
+		return "", nil, err
+	}
+	var fields = make([][]fieldModel, len(rows))
+	var now = time.Now()
+	for i := 0; i < len(rows); i++ {
+		if rows[i].Type() != rows[0].Type() {
+			return "", nil, TinySqlErrorParamInvalidError.Format(rows[i].Type().String()).Error()
+		}
+		fields[i] = structFields(rows[i], this.db.conn.namer())
+		touchFields(fields[i], now, true)
+	}
+	//需要写入的列在字段中的位置
+	var columns = make([]int, 0, len(fields[0]))
+	for j, f := range fields[0] {
+		if !this.allowColumn(f.name) {
+			continue
+		}
+		for i := 0; i < len(fields); i++ {
+			if !fields[i][j].omitInsert() {
+				columns = append(columns, j)
+				break
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return "", nil, TinySqlErrorParamInvalidError.Format("insert columns").Error()
+	}
+	query := "insert into " + t
+	keys := ""
+	for _, j := range columns {
+		keys += d.quote(fields[0][j].name) + ","
+	}
+	query += " (" + keys[:len(keys)-1] + ")"
+	query += this.outputSql("inserted")
+	query += " values"
+	params := make([]interface{}, 0, len(columns)*len(rows))
+	for i := 0; i < len(fields); i++ {
+		values := ""
+		for _, j := range columns {
+			var f = fields[i][j]
+			if f.omitInsert() {
+				if !d.valuesDefault {
+					return "", nil, TinySqlErrorUnsupportedError.Format(d.name, "values default").Error()
+				}
+				values += "default,"
+				continue
+			}
+			var param, err = f.param()
+			if err != nil {
+				return "", nil, err
+			}
+			values += "?,"
+			params = append(params, param)
+		}
+		query += " (" + values[:len(values)-1] + "),"
+	}
+	query = query[:len(query)-1]
+	query += this.returningSql()
+	return query, params, nil
+}
+
+// Only 限制Insert,InsertBatch及SetModel只写入指定的列
+func (this *builder) Only(cols ...string) *builder {
+	if this.only == nil {
+		this.only = make(map[string]bool)
+	}
+	for _, col := range cols {
+		this.only[strings.TrimSpace(col)] = true
+	}
+	return this
+}
+
+// Omit 限制Insert,InsertBatch及SetModel不写入指定的列
+func (this *builder) Omit(cols ...string) *builder {
+	if this.omit == nil {
+		this.omit = make(map[string]bool)
+	}
+	for _, col := range cols {
+		this.omit[strings.TrimSpace(col)] = true
+	}
+	return this
+}
+
+// allowColumn 列是否允许通过结构体写入
+func (this *builder) allowColumn(name string) bool {
+	if len(this.only) != 0 && !this.only[name] {
+		return false
+	}
+	return !this.omit[name]
+}
+
 // Set 为Update设置值
 func (this *builder) Set(key string, value interface{}) *builder {
 	if strings.Trim(key, " ") == "" {
 		return this
 	}
-	key = "`" + key + "`"
+	var err error
+	key, err = parseExpr(this.db.dialect, key, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
 	var temp = setModel{column: key, value: value}
 	this.set = append(this.set, temp)
 	return this
 }
 
-func (this *builder) toDeleteSql() (string, []interface{}) {
-	if len(this.from) != 1 {
-		return "", nil
+// SetExpr 使用表达式为Update设置值,表达式中可以使用?占位符,如 SetExpr("balance", "balance - ?", 10)
+//  表达式中的函数调用原样输出,expr不能来自外部输入,外部输入的值通过args传入
+func (this *builder) SetExpr(key string, expr string, args ...interface{}) *builder {
+	var col, err = parseExpr(this.db.dialect, key, exprColumn)
+	if err == nil {
+		expr, err = parseExpr(this.db.dialect, expr, exprValue)
 	}
-	var sql string
-	sql = "delete from " + this.from[0]
-	params := make([]interface{}, 0, 0)
-	if len(this.whereCondition) != 0 {
-		sql += " where "
-		isFirst := true
-		for i := 0; i < len(this.whereCondition); i++ {
-			var v = this.whereCondition[i]
-			//where group
-			if v.extCharPosition == 1 {
-				sql += " "
-				sql += strings.Repeat("(", v.extChar)
-			}
-			if v.isOr {
-				if !isFirst {
-					sql += " or "
-				} else {
-					isFirst = false
-				}
+	if err == nil && countPlaceholders(expr) != len(args) {
+		err = TinySqlErrorExprInvalidError.Format(expr).Error()
+	}
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	this.set = append(this.set, setModel{column: col, expr: expr, params: args})
+	return this
+}
 
-			} else {
-				if !isFirst {
-					sql += " and "
-				} else {
-					isFirst = false
-				}
+// SetColumn 将key设置为另一列的值
+func (this *builder) SetColumn(key string, column string) *builder {
+	return this.SetExpr(key, column)
+}
+
+// Increment 将key增加n
+func (this *builder) Increment(key string, n interface{}) *builder {
+	return this.SetExpr(key, key+" + ?", n)
+}
+
+// Decrement 将key减少n
+func (this *builder) Decrement(key string, n interface{}) *builder {
+	return this.SetExpr(key, key+" - ?", n)
+}
+
+// SetMap 使用map为Update设置多个值,按key排序
+func (this *builder) SetMap(data map[string]interface{}) *builder {
+	var keys = make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		this.Set(k, data[k])
+	}
+	return this
+}
+
+// SetModel 使用结构体为Update设置值,按字段定义的顺序设置
+//  标记为readonly,auto或autoCreateTime的字段不更新,标记为omitempty的字段为零值时不更新,受Only及Omit限制
+//  标记为autoUpdateTime的字段设置为当前时间,model为指针时同时修改结构体
+func (this *builder) SetModel(model interface{}) *builder {
+	var value = reflect.Indirect(reflect.ValueOf(model))
+	if value.Kind() != reflect.Struct {
+		this.setError(TinySqlErrorParamInvalidError.Format(value.Type().String()).Error())
+		return this
+	}
+	var fields = structFields(value, this.db.conn.namer())
+	touchFields(fields, time.Now(), false)
+	for _, f := range fields {
+		if f.omitUpdate() {
+			continue
+		}
+		var param, err = f.param()
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+		this.set = append(this.set, setModel{column: this.db.dialect.quote(f.name), value: param, field: f.name})
+	}
+	return this
+}
+
+// toUpdateSql 生成update语句,join按方言转换为对应的语法
+//  mysql: update t join j on ... set ... where ... order by ... limit n
+//  postgres,sqlite3: update t set ... from j where j的on条件 and (...)
+//  mssql: update t set ... from t join j on ... where ...
+func (this *builder) toUpdateSql(table tableModel) (string, []interface{}, error) {
+	var d = this.db.dialect
+	var err = this.checkFullTable("update")
+	if err != nil {
+		return "", nil, err
+	}
+	err = this.checkWriteLimit("update")
+	if err != nil {
+		return "", nil, err
+	}
+	var sql, params = this.withSql()
+	var sets, setParams = this.setSql()
+	if sets == "" {
+		return "", nil, TinySqlErrorParamInvalidError.Format("set").Error()
+	}
+	var on string
+	var onParams []interface{}
+	if len(this.join) == 0 {
+		sql += "update " + table.sql + " set " + sets + this.outputSql("inserted")
+		params = append(params, setParams...)
+	} else {
+		switch d.writeJoin {
+		case writeJoinUsing:
+			var from string
+			var fromParams []interface{}
+			from, fromParams, on, onParams, err = this.usingSql()
+			if err != nil {
+				return "", nil, err
 			}
-			if v.multiValue {
-				sql += (v.column + " in (")
-				sql += strings.Repeat("?,", len(v.values))
-				sql = sql[:len(sql)-1]
-				sql += (") ")
-				params = append(params, v.values...)
-			} else {
-				sql += (v.column + "? ")
-				params = append(params, v.value)
+			sql += "update " + table.sql + " set " + sets + this.outputSql("inserted") + " from " + from
+			params = append(params, setParams...)
+			params = append(params, fromParams...)
+		case writeJoinTarget:
+			var joins, joinParams = this.joinSql(this.join)
+			sql += "update " + table.ref + " set " + sets + this.outputSql("inserted") + " from " + table.sql + joins
+			params = append(params, setParams...)
+			params = append(params, joinParams...)
+		default:
+			var joins, joinParams = this.joinSql(this.join)
+			sql += "update " + table.sql + joins + " set " + sets + this.outputSql("inserted")
+			params = append(params, joinParams...)
+			params = append(params, setParams...)
+		}
+	}
+	on = andSql(on, this.trashedSql([]tableModel{table}))
+	var where, whereParams = this.whereSql(on, onParams)
+	sql += where
+	params = append(params, whereParams...)
+	sql += this.writeLimitSql()
+	params = append(params, this.orderParams...)
+	sql += this.returningSql()
+	return sql, params, nil
+}
+
+// toDeleteSql 生成delete语句,删除From中设置的表,join按方言转换为对应的语法
+//  mysql,mssql: delete t from t join j on ... where ...
+//  postgres: delete from t using j where j的on条件 and (...)
+//  使用软删除的表生成设置删除时间的update语句
+func (this *builder) toDeleteSql() (string, []interface{}, error) {
+	if len(this.from) != 1 {
+		return "", nil, TinySqlErrorParamInvalidError.Format("delete from").Error()
+	}
+	if s, ok := this.db.conn.softDelete(this.from[0].name); ok && !this.forceDelete {
+		var deletedAt, valid = timeValue(s.typ, time.Now())
+		if !valid {
+			return "", nil, TinySqlErrorParamInvalidError.Format(s.typ.String()).Error()
+		}
+		this.set = []setModel{{column: this.db.dialect.quote(s.column), value: deletedAt.Interface()}}
+		return this.toUpdateSql(this.from[0])
+	}
+	var d = this.db.dialect
+	var err = this.checkFullTable("delete")
+	if err != nil {
+		return "", nil, err
+	}
+	err = this.checkWriteLimit("delete")
+	if err != nil {
+		return "", nil, err
+	}
+	var table = this.from[0]
+	var sql, params = this.withSql()
+	var on string
+	var onParams []interface{}
+	if len(this.join) == 0 {
+		sql += "delete from " + table.sql + this.outputSql("deleted")
+	} else {
+		switch d.writeJoin {
+		case writeJoinUsing:
+			if !d.deleteUsing {
+				return "", nil, TinySqlErrorUnsupportedError.Format(d.name, "delete join").Error()
 			}
-			// where group
-			if v.extCharPosition == 2 {
-				sql += " "
-				sql += strings.Repeat(")", v.extChar)
+			var using string
+			var usingParams []interface{}
+			using, usingParams, on, onParams, err = this.usingSql()
+			if err != nil {
+				return "", nil, err
 			}
+			sql += "delete from " + table.sql + " using " + using
+			params = append(params, usingParams...)
+		default:
+			var joins, joinParams = this.joinSql(this.join)
+			sql += "delete " + table.ref + this.outputSql("deleted") + " from " + table.sql + joins
+			params = append(params, joinParams...)
 		}
 	}
-	if this.groupEnd != 0 {
-		sql += strings.Repeat(")", this.groupEnd)
+	on = andSql(on, this.trashedSql(this.from))
+	var where, whereParams = this.whereSql(on, onParams)
+	sql += where
+	params = append(params, whereParams...)
+	sql += this.writeLimitSql()
+	params = append(params, this.orderParams...)
+	sql += this.returningSql()
+	return sql, params, nil
+}
+
+// setSql 生成update的赋值语句
+func (this *builder) setSql() (string, []interface{}) {
+	var sql = ""
+	var params = make([]interface{}, 0, len(this.set))
+	for i := 0; i < len(this.set); i++ {
+		if this.set[i].field != "" && !this.allowColumn(this.set[i].field) {
+			continue
+		}
+		if this.set[i].expr != "" {
+			sql += (this.set[i].column + "=" + this.set[i].expr + ",")
+			params = append(params, this.set[i].params...)
+		} else {
+			sql += (this.set[i].column + "=?,")
+			params = append(params, this.set[i].value)
+		}
+	}
+	if sql == "" {
+		return "", params
+	}
+	return sql[:len(sql)-1], params
+}
+
+// whereSql 生成where语句
+//  on:需要合并到where中的join条件,可以为空
+func (this *builder) whereSql(on string, onParams []interface{}) (string, []interface{}) {
+	var params = make([]interface{}, 0, 0)
+	params = append(params, onParams...)
+	if this.condition.empty() {
+		if on == "" {
+			return "", params
+		}
+		return " where " + on, params
+	}
+	var where, whereParams = this.condition.toSql()
+	params = append(params, whereParams...)
+	if on == "" {
+		return " where " + where, params
+	}
+	return " where (" + on + ") and (" + where + ")", params
+}
+
+// usingSql 将join转换为update ... from及delete ... using的形式,第一个join的on条件需要合并到where中
+//  return:(from或using后的表,表的参数,第一个join的on条件,on条件的参数,错误)
+func (this *builder) usingSql() (string, []interface{}, string, []interface{}, error) {
+	var first = this.join[0]
+	if (first.joinType != "join" && first.joinType != "cross join") || first.using != "" {
+		return "", nil, "", nil, TinySqlErrorUnsupportedError.Format(this.db.dialect.name, first.joinType+" in update/delete").Error()
+	}
+	var joins, joinParams = this.joinSql(this.join[1:])
+	var params = make([]interface{}, 0, 0)
+	params = append(params, first.tableParams...)
+	params = append(params, joinParams...)
+	return first.table + joins, params, this.joinCondition(first), first.params, nil
+}
+
+// joinCondition 返回join的on条件,使用软删除的表需要排除已删除的行
+func (this *builder) joinCondition(j joinModel) string {
+	if j.condition == "" {
+		return ""
+	}
+	return andSql(j.condition, this.softDeleteSql(j.ref, j.name))
+}
+
+// trashedSql 生成排除已删除行的条件,作用于tables及没有on条件的内连接的表
+func (this *builder) trashedSql(tables []tableModel) string {
+	var sql = ""
+	for _, t := range tables {
+		sql = andSql(sql, this.softDeleteSql(t.ref, t.name))
+	}
+	for _, j := range this.join {
+		if j.condition == "" && (j.joinType == "join" || j.joinType == "cross join") {
+			sql = andSql(sql, this.softDeleteSql(j.ref, j.name))
+		}
+	}
+	return sql
+}
+
+// softDeleteSql 生成表的 deleted_at is null 条件,表未使用软删除或调用了WithTrashed时返回空
+//  ref:引用该表时使用的名称
+//  name:不包含数据库名及别名的表名
+func (this *builder) softDeleteSql(ref string, name string) string {
+	if this.withTrashed || name == "" {
+		return ""
+	}
+	var s, ok = this.db.conn.softDelete(name)
+	if !ok {
+		return ""
+	}
+	return ref + "." + this.db.dialect.quote(s.column) + " is null"
+}
+
+// WithTrashed 查询,更新及删除时包含已被软删除的行
+func (this *builder) WithTrashed() *builder {
+	this.withTrashed = true
+	return this
+}
+
+// andSql 使用and连接两个条件,忽略空的条件
+func andSql(a string, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return "(" + a + ") and " + b
+}
+
+// AllowFullTable 允许当前的Update或Delete不带任何条件,作用于整张表
+func (this *builder) AllowFullTable() *builder {
+	this.fullTable = true
+	return this
+}
+
+// checkFullTable 检查update及delete是否带有where条件,防止误操作整张表
+//  join不视为条件,left join,cross join等不会减少目标表中被修改的行
+func (this *builder) checkFullTable(op string) error {
+	if !this.condition.empty() || this.fullTable || this.db.conn.allowFullTable {
+		return nil
+	}
+	return TinySqlErrorFullTableError.Format(op).Error()
+}
+
+// checkWriteLimit 检查update及delete能否使用order by及limit,只有mysql的单表语句支持
+func (this *builder) checkWriteLimit(op string) error {
+	if len(this.orderby) == 0 && this.limit == 0 {
+		return nil
+	}
+	if !this.db.dialect.writeLimit || len(this.join) != 0 || this.offset != 0 {
+		return TinySqlErrorUnsupportedError.Format(this.db.dialect.name, op+" order by/limit").Error()
+	}
+	return nil
+}
+
+// writeLimitSql 生成update及delete的order by及limit语句
+func (this *builder) writeLimitSql() string {
+	var sql = ""
+	if len(this.orderby) != 0 {
+		sql += " order by " + strings.Join(this.orderby, ",")
+	}
+	if this.limit != 0 {
+		sql += " limit " + strconv.Itoa(this.limit)
+	}
+	return sql
+}
+
+// joinSql 生成join语句
+func (this *builder) joinSql(joins []joinModel) (string, []interface{}) {
+	var sql = ""
+	var params = make([]interface{}, 0, 0)
+	for i := 0; i < len(joins); i++ {
+		sql += " " + joins[i].joinType + " " + joins[i].table
+		if joins[i].condition != "" {
+			sql += " on " + this.joinCondition(joins[i])
+		}
+		if joins[i].using != "" {
+			sql += " using (" + joins[i].using + ")"
+		}
+		params = append(params, joins[i].tableParams...)
+		params = append(params, joins[i].params...)
 	}
-	fmt.Println("[TinySql]", sql)
 	return sql, params
 }
 
@@ -398,28 +1192,49 @@ func (this *builder) From(table string) *builder {
 		return this
 	}
 	t := strings.Split(table, ",")
-	if len(t) == 0 {
-		return this
-	}
 	for i := 0; i < len(t); i++ {
-		t[i] = addDelimiter(t[i], 2)
+		var m, err = parseTable(this.db.dialect, t[i])
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+		this.from = append(this.from, m)
 	}
-	this.from = append(this.from, t...)
 	return this
 }
 
 // Count 返回符合条件的结果数量
 // @param reset 查询完成后是否重置
 func (this *builder) Count(reset bool) int {
-	var temp = this.columns
-	this.columns = []string{"count(*) as c"}
+	this.lastErr = this.err
+	if this.lastErr != nil {
+		if reset {
+			this.reset()
+		}
+		return -1
+	}
 	var c countModel
-	var sql, params = this.toQuerySql()
-	//去掉limit
-	var aa, _ = regexp.Compile("limit \\d+,\\d+")
-	sql = aa.ReplaceAllString(sql, "")
-	this.db.Query(sql, params...).Scan(&c)
-	this.columns = temp
+	//统计时不加锁,去掉order by及limit,未分组的列不能出现在order by中
+	var tempLock, tempOrder, tempOrderParams, tempLimit = this.lock, this.orderby, this.orderParams, this.limit
+	this.lock = ""
+	this.orderby = nil
+	this.orderParams = nil
+	this.limit = 0
+	if len(this.unions) != 0 {
+		//组合查询统计合并后的结果
+		var sql, params = this.selectSql()
+		var with, withParams = this.withSql()
+		sql = with + "select count(*) as c from (" + sql + ") as " + this.db.dialect.quote("t")
+		_, this.lastErr = this.query(sql, append(withParams, params...)).Scan(&c)
+	} else {
+		var temp, tempParams = this.columns, this.columnParams
+		this.columns = []string{"count(*) as c"}
+		this.columnParams = nil
+		var sql, params = this.toQuerySql()
+		_, this.lastErr = this.query(sql, params).Scan(&c)
+		this.columns, this.columnParams = temp, tempParams
+	}
+	this.lock, this.orderby, this.orderParams, this.limit = tempLock, tempOrder, tempOrderParams, tempLimit
 	if reset {
 		this.reset()
 	}
@@ -433,14 +1248,12 @@ func (this *builder) SelectCount(col string) *builder {
 	} else if strings.Trim(col, " ") == "" {
 		this.columns = append(this.columns, "count(1)")
 	} else {
-		if strings.Contains(col, ".") {
-			var df = strings.Split(col, ".")
-			col = ""
-			for j := 0; j < len(df); j++ {
-				col += "`" + df[j] + "`" + "."
-			}
+		var c, err = parseExpr(this.db.dialect, col, exprColumn)
+		if err != nil {
+			this.setError(err)
+			return this
 		}
-		this.columns = append(this.columns, "count(`"+col[:len(col)-1]+"`)")
+		this.columns = append(this.columns, "count("+c+")")
 	}
 	return this
 }
@@ -462,218 +1275,376 @@ func (this *builder) SelectSum(col string) *builder {
 }
 
 func (this *builder) LeftJoin(table string, condition string) *builder {
-	table = addDelimiter(table, 2)
-	var jc = joinModel{table: table, condition: condition, joinType: " left "}
-	this.join = append(this.join, jc)
-	return this
+	return this.addJoin("left join", table, condition)
 }
 
 func (this *builder) RightJoin(table string, condition string) *builder {
-	table = addDelimiter(table, 2)
-	var jc = joinModel{table: table, condition: condition, joinType: " right "}
+	return this.addJoin("right join", table, condition)
+}
+
+func (this *builder) Join(table string, condition string) *builder {
+	return this.addJoin("join", table, condition)
+}
+
+// FullJoin 全外连接,mysql不支持
+func (this *builder) FullJoin(table string, condition string) *builder {
+	if !this.db.dialect.fullJoin {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "full join").Error())
+		return this
+	}
+	return this.addJoin("full join", table, condition)
+}
+
+// CrossJoin 交叉连接
+func (this *builder) CrossJoin(table string) *builder {
+	var t, err = parseTable(this.db.dialect, table)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	this.join = append(this.join, joinModel{table: t.sql, ref: t.ref, name: t.name, joinType: "cross join"})
+	return this
+}
+
+// JoinUsing 使用同名列连接,如 JoinUsing("orders", "user_id"),mssql不支持
+func (this *builder) JoinUsing(table string, columns ...string) *builder {
+	if !this.db.dialect.joinUsing {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "join using").Error())
+		return this
+	}
+	var t, err = parseTable(this.db.dialect, table)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var cols = make([]string, len(columns))
+	for i := 0; i < len(columns); i++ {
+		cols[i], err = parseExpr(this.db.dialect, columns[i], exprColumn)
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+	}
+	this.join = append(this.join, joinModel{table: t.sql, ref: t.ref, name: t.name, using: strings.Join(cols, ","), joinType: "join"})
+	return this
+}
+
+// JoinOn 使用结构化的条件连接,条件中可以比较列与列,也可以比较列与值
+//  JoinOn("orders o", func(on *Cond) { on.On("o.user_id", "u.id").Where("o.status", 1) })
+func (this *builder) JoinOn(table string, fn func(on *Cond)) *builder {
+	return this.addJoinOn("join", table, fn)
+}
+
+// LeftJoinOn 使用结构化的条件左连接
+func (this *builder) LeftJoinOn(table string, fn func(on *Cond)) *builder {
+	return this.addJoinOn("left join", table, fn)
+}
+
+// RightJoinOn 使用结构化的条件右连接
+func (this *builder) RightJoinOn(table string, fn func(on *Cond)) *builder {
+	return this.addJoinOn("right join", table, fn)
+}
+
+// FullJoinOn 使用结构化的条件全外连接,mysql不支持
+func (this *builder) FullJoinOn(table string, fn func(on *Cond)) *builder {
+	if !this.db.dialect.fullJoin {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "full join").Error())
+		return this
+	}
+	return this.addJoinOn("full join", table, fn)
+}
+
+// JoinSub 连接子查询
+//  sub:子查询
+//  alias:子查询的别名
+func (this *builder) JoinSub(sub *builder, alias string, fn func(on *Cond)) *builder {
+	return this.addJoinSub("join", sub, alias, fn)
+}
+
+// LeftJoinSub 左连接子查询
+func (this *builder) LeftJoinSub(sub *builder, alias string, fn func(on *Cond)) *builder {
+	return this.addJoinSub("left join", sub, alias, fn)
+}
+
+// addJoin 添加join,table支持别名,condition中的列会被添加限定符
+func (this *builder) addJoin(joinType string, table string, condition string) *builder {
+	var t, err = parseTable(this.db.dialect, table)
+	if err == nil {
+		condition, err = parseExpr(this.db.dialect, condition, exprCondition)
+	}
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var jc = joinModel{table: t.sql, ref: t.ref, name: t.name, condition: condition, joinType: joinType}
 	this.join = append(this.join, jc)
 	return this
 }
 
-func (this *builder) Join(table string, condition string) *builder {
-	table = addDelimiter(table, 2)
-	var jc = joinModel{table: table, condition: condition, joinType: ""}
+// addJoinOn 添加使用结构化条件的join
+func (this *builder) addJoinOn(joinType string, table string, fn func(on *Cond)) *builder {
+	var t, err = parseTable(this.db.dialect, table)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	return this.addJoinCond(joinType, t, nil, fn)
+}
+
+// addJoinSub 添加子查询join
+func (this *builder) addJoinSub(joinType string, sub *builder, alias string, fn func(on *Cond)) *builder {
+	if sub.err != nil {
+		this.setError(sub.err)
+		return this
+	}
+	var a, err = parseExpr(this.db.dialect, alias, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var sql, params = sub.toQuerySql()
+	return this.addJoinCond(joinType, tableModel{sql: "(" + sql + ") as " + a, ref: a}, params, fn)
+}
+
+// addJoinCond 生成on条件并添加join
+func (this *builder) addJoinCond(joinType string, table tableModel, params []interface{}, fn func(on *Cond)) *builder {
+	var on = newCond(this.db.dialect)
+	fn(&on)
+	if on.err != nil {
+		this.setError(on.err)
+		return this
+	}
+	var jc = joinModel{table: table.sql, ref: table.ref, name: table.name, joinType: joinType, tableParams: params}
+	if !on.empty() {
+		jc.condition, jc.params = on.toSql()
+	}
 	this.join = append(this.join, jc)
 	return this
 }
 
 //func (this *Builder) GroupBy(col string) *Builder{
 
-//	return this
+//  return this
 //}
 
 func (this *builder) GroupStart() *builder {
-	this.groupStart++
+	this.condition.GroupStart()
 	return this
 }
 
 func (this *builder) GroupEnd() *builder {
-	this.groupEnd++
+	this.condition.GroupEnd()
 	return this
 }
 
-// Select 支持逗号分隔的多个列
+// Select 支持逗号分隔的多个列,列可以是函数调用并带有as别名,如 count(distinct user_id) as n
+//  警告:表达式中的函数调用原样输出,columns绝不能来自外部输入,否则可以调用 load_file('/etc/passwd'),pg_sleep(10) 等函数,
+//  外部输入的列需要先与允许的列名比对
 func (this *builder) Select(columns string) *builder {
-	s := strings.Split(columns, ",")
-	if len(s) == 0 {
-		return this
-	}
+	s := splitExpr(columns)
 	for i := 0; i < len(s); i++ {
-		if s[i] == "*" {
+		if strings.Trim(s[i], " ") == "*" {
+			s[i] = "*"
 			continue
 		}
-		s[i] = addDelimiter(s[i], 3)
+		var col, err = parseExpr(this.db.dialect, s[i], exprSelect)
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+		s[i] = col
 	}
 	this.columns = append(this.columns, s...)
 	return this
 }
 
+// SelectModel 查询table中model的字段对应的列,用于join时将各表的列解析到嵌套的结构体
+//  table:表名或别名
+//  model:结构体或结构体指针,嵌套的结构体字段需要单独调用SelectModel
+//  prefix:列别名的前缀,为空时不使用别名,嵌套的字段 User User 使用 user__,带有标签 db:"user,prefix=u_" 时使用 u_
+//  b.From("orders o").LeftJoin("users u", "u.id = o.user_id").SelectModel("o", Order{}, "").SelectModel("u", User{}, "user__")
+func (this *builder) SelectModel(table string, model interface{}, prefix string) *builder {
+	var t, err = parseExpr(this.db.dialect, table, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var typ = reflect.TypeOf(model)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		this.setError(TinySqlErrorParamInvalidError.Format(typ.String()).Error())
+		return this
+	}
+	for _, col := range modelColumns(typ, this.db.conn.namer()) {
+		var c = t + "." + this.db.dialect.quote(col)
+		if prefix != "" {
+			c += " as " + this.db.dialect.quote(prefix+col)
+		}
+		this.columns = append(this.columns, c)
+	}
+	return this
+}
+
+// SelectRaw 添加原样输出的列表达式,表达式中可以使用?占位符
+func (this *builder) SelectRaw(expr string, args ...interface{}) *builder {
+	this.columns = append(this.columns, expr)
+	this.columnParams = append(this.columnParams, args...)
+	return this
+}
+
+// SelectWindow 添加窗口函数列,如 SelectWindow("row_number()", "user_id", "created_at desc", "rn")
+//  fn:窗口函数或聚合函数,如 rank(),lag(price,1),sum(amount)
+//  partitionBy:逗号分隔的分区列,可以为空
+//  orderBy:逗号分隔的排序表达式,可以为空
+//  alias:列别名,可以为空
+func (this *builder) SelectWindow(fn string, partitionBy string, orderBy string, alias string) *builder {
+	var f, err = parseExpr(this.db.dialect, fn, exprCondition)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var spec string
+	spec, err = this.windowSpec(partitionBy, orderBy)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	return this.addWindowColumn(f+" over ("+spec+")", alias)
+}
+
+// SelectOver 添加使用命名窗口的窗口函数列,窗口需要通过Window定义
+func (this *builder) SelectOver(fn string, window string, alias string) *builder {
+	var f, err = parseExpr(this.db.dialect, fn, exprCondition)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var w string
+	w, err = parseExpr(this.db.dialect, window, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	return this.addWindowColumn(f+" over "+w, alias)
+}
+
+// Window 定义命名窗口,生成 window name as (partition by ... order by ...),mssql不支持
+func (this *builder) Window(name string, partitionBy string, orderBy string) *builder {
+	if !this.db.dialect.namedWindow {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "window").Error())
+		return this
+	}
+	var n, err = parseExpr(this.db.dialect, name, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var spec string
+	spec, err = this.windowSpec(partitionBy, orderBy)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	this.windows = append(this.windows, n+" as ("+spec+")")
+	return this
+}
+
+// windowSpec 生成窗口定义 partition by ... order by ...
+func (this *builder) windowSpec(partitionBy string, orderBy string) (string, error) {
+	var parts = make([]string, 0, 2)
+	if strings.Trim(partitionBy, " ") != "" {
+		var cols = splitExpr(partitionBy)
+		for i := 0; i < len(cols); i++ {
+			var c, err = parseExpr(this.db.dialect, cols[i], exprCondition)
+			if err != nil {
+				return "", err
+			}
+			cols[i] = c
+		}
+		parts = append(parts, "partition by "+strings.Join(cols, ","))
+	}
+	if strings.Trim(orderBy, " ") != "" {
+		var cols = splitExpr(orderBy)
+		for i := 0; i < len(cols); i++ {
+			var c, err = parseExpr(this.db.dialect, cols[i], exprOrder)
+			if err != nil {
+				return "", err
+			}
+			cols[i] = c
+		}
+		parts = append(parts, "order by "+strings.Join(cols, ","))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func (this *builder) addWindowColumn(col string, alias string) *builder {
+	if strings.Trim(alias, " ") != "" {
+		var a, err = parseExpr(this.db.dialect, alias, exprColumn)
+		if err != nil {
+			this.setError(err)
+			return this
+		}
+		col += " as " + a
+	}
+	this.columns = append(this.columns, col)
+	return this
+}
+
 func (this *builder) Where(key string, val interface{}) *builder {
-	return this.where(key, val, "and")
+	this.condition.Where(key, val)
+	this.setError(this.condition.err)
+	return this
 }
 
 func (this *builder) OrWhere(key string, val interface{}) *builder {
-	return this.where(key, val, "or")
+	this.condition.OrWhere(key, val)
+	this.setError(this.condition.err)
+	return this
 }
 
 func (this *builder) WhereIn(key string, val []interface{}) *builder {
-	return this.whereIn(key, val, "and")
+	this.condition.WhereIn(key, val)
+	this.setError(this.condition.err)
+	return this
 }
 
 func (this *builder) OrWhereIn(key string, val []interface{}) *builder {
-	return this.whereIn(key, val, "or")
+	this.condition.OrWhereIn(key, val)
+	this.setError(this.condition.err)
+	return this
 }
 
-func (this *builder) Limit(limit int, offset int) *builder {
-	this.limit = limit
-	this.offset = offset
+// WhereJSON 添加json列中指定路径的值与val比较的条件,如 WhereJSON("settings->theme", "dark")
+func (this *builder) WhereJSON(key string, val interface{}) *builder {
+	this.condition.WhereJSON(key, val)
+	this.setError(this.condition.err)
 	return this
 }
 
-func (this *builder) maxMinAvgSum(col string, t string) *builder {
-	if strings.Trim(col, " ") == "" {
-		return this
-	}
-	this.columns = append(this.columns, t+"(`"+col+"`)")
+// OrWhereJSON 以or连接json路径的条件
+func (this *builder) OrWhereJSON(key string, val interface{}) *builder {
+	this.condition.OrWhereJSON(key, val)
+	this.setError(this.condition.err)
 	return this
 }
 
-func (this *builder) where(key string, val interface{}, t string) *builder {
-	ext := strings.ContainsAny(key, "<=>")
-	if ext {
-		var p = strings.IndexAny(key, "<=>")
-		var keyName = key[:p]
-		var symbol = key[p:]
-		//处理限定,如database.table.column
-		key = addDelimiter(keyName, 1) + symbol
-	} else {
-		//处理限定,如database.table.column
-		key = addDelimiter(key, 1) + "="
-	}
-	var aa = new(whereConstraint)
-	if strings.ToUpper(t) == "OR" {
-		aa.isOr = true
-	}
-	if strings.ToUpper(t) == "AND" {
-		aa.isOr = false
-	}
-	aa.multiValue = false
-	aa.value = val
-	if this.groupStart != 0 {
-		aa.extCharPosition = 1
-		aa.extChar = this.groupStart
-		this.groupStart = 0
-	} else if this.groupEnd != 0 {
-		aa.extCharPosition = 2
-		aa.extChar = this.groupEnd
-		this.groupEnd = 0
-	} else {
-		aa.extCharPosition = 0
-	}
-	aa.column = key
-	this.whereCondition = append(this.whereCondition, *aa)
+func (this *builder) Limit(limit int, offset int) *builder {
+	this.limit = limit
+	this.offset = offset
 	return this
 }
 
-func (this *builder) whereIn(key string, val []interface{}, t string) *builder {
-	var aa = new(whereConstraint)
-	if strings.ToUpper(t) == "OR" {
-		aa.isOr = true
-	}
-	if strings.ToUpper(t) == "AND" {
-		aa.isOr = false
+func (this *builder) maxMinAvgSum(col string, t string) *builder {
+	if strings.Trim(col, " ") == "" {
+		return this
 	}
-	aa.multiValue = true
-	aa.values = val
-	if this.groupStart != 0 {
-		aa.extCharPosition = 1
-		aa.extChar = this.groupStart
-		this.groupStart = 0
-	} else if this.groupEnd != 0 {
-		aa.extCharPosition = 2
-		aa.extChar = this.groupEnd
-		this.groupEnd = 0
-	} else {
-		aa.extCharPosition = 0
+	var c, err = parseExpr(this.db.dialect, col, exprCondition)
+	if err != nil {
+		this.setError(err)
+		return this
 	}
-	//处理限定,如database.table.column
-
-	key = addDelimiter(key, 1)
-	aa.column = key
-	this.whereCondition = append(this.whereCondition, *aa)
+	this.columns = append(this.columns, t+"("+c+")")
 	return this
 }
-
-// addDelimiter 添加限定符(表名,列明)
-// @param t 添加类型,1 database.table.column 2 table as alias
-func addDelimiter(s string, t int) string {
-	switch t {
-	case 1:
-		{
-			var segments = strings.Split(s, ".")
-			s = ""
-			for i := 0; i < len(segments); i++ {
-				if segments[i] == "*" {
-					s += segments[i] + "."
-					continue
-				}
-				s += "`" + segments[i] + "`" + "."
-			}
-			return s[:len(s)-1]
-		}
-	case 2:
-		{
-			var segments = strings.Split(s, " ")
-			s = "`" + segments[0] + "`"
-			for i := 1; i < len(segments); i++ {
-				s += " " + segments[i]
-			}
-			return s
-		}
-	case 3:
-		{
-			var segments = strings.Split(s, " ")
-			s = addDelimiter(segments[0], 1)
-			for i := 1; i < len(segments); i++ {
-				s += " " + segments[i]
-			}
-			return s
-		}
-	default:
-		return s
-	}
-}
-
-// mapStructToMap 将一个结构体所有字段(包括通过组合得来的字段)到一个map中
-// value:结构体的反射值
-// data:存储字段数据的map
-func mapStructToMap(value reflect.Value, data map[string]interface{}) {
-	if value.Kind() == reflect.Struct {
-		for i := 0; i < value.NumField(); i++ {
-			var fieldValue = value.Field(i)
-			if fieldValue.CanInterface() {
-				var fieldType = value.Type().Field(i)
-				if fieldType.Anonymous {
-					//匿名组合字段,进行递归解析
-					mapStructToMap(fieldValue, data)
-				} else {
-					//非匿名字段
-					var fieldName = fieldType.Tag.Get("db")
-					if fieldName == "-" {
-						continue
-					}
-					if fieldName == "" {
-						fieldName = transFieldName(fieldType.Name)
-					}
-					data[fieldName] = fieldValue.Interface()
-					//fmt.Println(fieldName + ":" + fieldValue.Interface().(string))
-				}
-			}
-		}
-	}
-}
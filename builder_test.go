@@ -0,0 +1,249 @@
+package tinysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testBase struct {
+	ID    int    `db:"id,pk,auto"`
+	Email string `db:"email"`
+}
+
+// 组合的字段按定义的位置排列在name之后
+type testUser struct {
+	Name string
+	testBase
+	Status int `db:"status,default"`
+}
+
+// sqlCase 生成sql的测试用例
+//  want:各方言期望的sql,为空时期望返回错误
+//  params:期望的参数,各方言相同
+type sqlCase struct {
+	name   string
+	build  func(d *dialect, b *builder) (string, []interface{}, error)
+	want   map[string]string
+	params []interface{}
+}
+
+func testBuilder(d *dialect) *builder {
+	var db = &DB{dialect: d, autoCommit: true, conn: &connection{}}
+	return db.NewBuilder()
+}
+
+func runSqlCases(t *testing.T, cases []sqlCase) {
+	for _, c := range cases {
+		for _, d := range testDialects {
+			var sql, params, err = c.build(d, testBuilder(d))
+			var want = c.want[d.name]
+			if want == "" {
+				if err == nil {
+					t.Errorf("%s %s: want error, got %q", c.name, d.name, sql)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s: %v", c.name, d.name, err)
+				continue
+			}
+			if sql != want {
+				t.Errorf("%s %s:\n got %q\nwant %q", c.name, d.name, sql, want)
+			}
+			if !reflect.DeepEqual(params, c.params) {
+				t.Errorf("%s %s: params %#v, want %#v", c.name, d.name, params, c.params)
+			}
+		}
+	}
+}
+
+func TestQuerySql(t *testing.T) {
+	runSqlCases(t, []sqlCase{
+		{
+			name: "order and limit",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				var sql, params = b.From("users").Where("id", 1).OrderBy("name desc").Limit(10, 20).toQuerySql()
+				return sql, params, b.err
+			},
+			want: map[string]string{
+				"mysql":    "select  *  from `users` where `id`=? order by `name` desc limit 20,10",
+				"postgres": `select  *  from "users" where "id"=? order by "name" desc limit 10 offset 20`,
+				"sqlite3":  `select  *  from "users" where "id"=? order by "name" desc limit 10 offset 20`,
+				"mssql":    "select  *  from [users] where [id]=? order by [name] desc offset 20 rows fetch next 10 rows only",
+			},
+			params: []interface{}{1},
+		},
+		{
+			name: "join and grouped conditions",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				var sql, params = b.Select("u.id, count(o.id) as n").From("users u").
+					LeftJoin("orders o", "o.user_id = u.id").Where("u.status", 1).
+					GroupStart().Where("u.age>=", 18).OrWhereIn("u.role", []interface{}{"a", "b"}).GroupEnd().toQuerySql()
+				return sql, params, b.err
+			},
+			want: map[string]string{
+				"mysql":    "select `u`.`id`,count(`o`.`id`) as `n` from `users` as `u` left join `orders` as `o` on `o`.`user_id` = `u`.`id` where `u`.`status`=? and (`u`.`age`>=? or `u`.`role` in (?,?))",
+				"postgres": `select "u"."id",count("o"."id") as "n" from "users" as "u" left join "orders" as "o" on "o"."user_id" = "u"."id" where "u"."status"=? and ("u"."age">=? or "u"."role" in (?,?))`,
+				"sqlite3":  `select "u"."id",count("o"."id") as "n" from "users" as "u" left join "orders" as "o" on "o"."user_id" = "u"."id" where "u"."status"=? and ("u"."age">=? or "u"."role" in (?,?))`,
+				"mssql":    "select [u].[id],count([o].[id]) as [n] from [users] as [u] left join [orders] as [o] on [o].[user_id] = [u].[id] where [u].[status]=? and ([u].[age]>=? or [u].[role] in (?,?))",
+			},
+			params: []interface{}{1, 18, "a", "b"},
+		},
+		{
+			name: "with and union",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				var sql, params = b.With("c", testBuilder(d).From("x").Where("k", 1)).From("c").Where("v", 2).
+					Union(testBuilder(d).From("y").Where("w", 3)).toQuerySql()
+				return sql, params, b.err
+			},
+			want: map[string]string{
+				"mysql":    "with `c` as (select  *  from `x` where `k`=?) (select  *  from `c` where `v`=?) union (select  *  from `y` where `w`=?)",
+				"postgres": `with "c" as (select  *  from "x" where "k"=?) (select  *  from "c" where "v"=?) union (select  *  from "y" where "w"=?)`,
+				"sqlite3":  `with "c" as (select  *  from "x" where "k"=?) select  *  from "c" where "v"=? union select  *  from "y" where "w"=?`,
+				"mssql":    "with [c] as (select  *  from [x] where [k]=?) (select  *  from [c] where [v]=?) union (select  *  from [y] where [w]=?)",
+			},
+			params: []interface{}{1, 2, 3},
+		},
+	})
+}
+
+func TestInsertSql(t *testing.T) {
+	var insert = func(rows ...testUser) func(d *dialect, b *builder) (string, []interface{}, error) {
+		return func(d *dialect, b *builder) (string, []interface{}, error) {
+			var values = make([]reflect.Value, len(rows))
+			for i := range rows {
+				values[i] = reflect.ValueOf(&rows[i]).Elem()
+			}
+			return b.toInsertSql("users", values)
+		}
+	}
+	runSqlCases(t, []sqlCase{
+		{
+			name:  "embedded field order",
+			build: insert(testUser{Name: "a", testBase: testBase{Email: "e"}, Status: 2}),
+			want: map[string]string{
+				"mysql":    "insert into `users` (`name`,`email`,`status`) values (?,?,?)",
+				"postgres": `insert into "users" ("name","email","status") values (?,?,?)`,
+				"sqlite3":  `insert into "users" ("name","email","status") values (?,?,?)`,
+				"mssql":    "insert into [users] ([name],[email],[status]) values (?,?,?)",
+			},
+			params: []interface{}{"a", "e", 2},
+		},
+		{
+			name:  "default in multi-row insert",
+			build: insert(testUser{Name: "a", Status: 2}, testUser{Name: "b", testBase: testBase{ID: 7}}),
+			want: map[string]string{
+				"mysql":    "insert into `users` (`name`,`id`,`email`,`status`) values (?,default,?,?), (?,?,?,default)",
+				"postgres": `insert into "users" ("name","id","email","status") values (?,default,?,?), (?,?,?,default)`,
+				"mssql":    "insert into [users] ([name],[id],[email],[status]) values (?,default,?,?), (?,?,?,default)",
+			},
+			params: []interface{}{"a", "", 2, "b", 7, ""},
+		},
+		{
+			name: "only",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				var u = testUser{Name: "a", testBase: testBase{ID: 3, Email: "e"}, Status: 2}
+				return b.Only("id", "status").toInsertSql("users", []reflect.Value{reflect.ValueOf(u)})
+			},
+			want: map[string]string{
+				"mysql":    "insert into `users` (`id`,`status`) values (?,?)",
+				"postgres": `insert into "users" ("id","status") values (?,?)`,
+				"sqlite3":  `insert into "users" ("id","status") values (?,?)`,
+				"mssql":    "insert into [users] ([id],[status]) values (?,?)",
+			},
+			params: []interface{}{3, 2},
+		},
+	})
+}
+
+func TestUpdateSql(t *testing.T) {
+	var table = func(d *dialect, s string) tableModel {
+		var t, _ = parseTable(d, s)
+		return t
+	}
+	runSqlCases(t, []sqlCase{
+		{
+			name: "set and expression",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				b.Set("name", "n").SetExpr("balance", "balance - ?", 5).Where("id", 1)
+				return b.toUpdateSql(table(d, "users"))
+			},
+			want: map[string]string{
+				"mysql":    "update `users` set `name`=?,`balance`=`balance` - ? where `id`=?",
+				"postgres": `update "users" set "name"=?,"balance"="balance" - ? where "id"=?`,
+				"sqlite3":  `update "users" set "name"=?,"balance"="balance" - ? where "id"=?`,
+				"mssql":    "update [users] set [name]=?,[balance]=[balance] - ? where [id]=?",
+			},
+			params: []interface{}{"n", 5, 1},
+		},
+		{
+			name: "join",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				b.Join("orders o", "o.user_id = u.id").Set("name", "n").Where("o.id", 1)
+				return b.toUpdateSql(table(d, "users u"))
+			},
+			want: map[string]string{
+				"mysql":    "update `users` as `u` join `orders` as `o` on `o`.`user_id` = `u`.`id` set `name`=? where `o`.`id`=?",
+				"postgres": `update "users" as "u" set "name"=? from "orders" as "o" where ("o"."user_id" = "u"."id") and ("o"."id"=?)`,
+				"sqlite3":  `update "users" as "u" set "name"=? from "orders" as "o" where ("o"."user_id" = "u"."id") and ("o"."id"=?)`,
+				"mssql":    "update [u] set [name]=? from [users] as [u] join [orders] as [o] on [o].[user_id] = [u].[id] where [o].[id]=?",
+			},
+			params: []interface{}{"n", 1},
+		},
+		{
+			name: "left join is not a condition",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				b.LeftJoin("orders o", "o.user_id = u.id").Set("name", "n")
+				return b.toUpdateSql(table(d, "users u"))
+			},
+			want: map[string]string{},
+		},
+	})
+}
+
+func TestDeleteSql(t *testing.T) {
+	runSqlCases(t, []sqlCase{
+		{
+			name: "where",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				return b.From("users").Where("id", 1).toDeleteSql()
+			},
+			want: map[string]string{
+				"mysql":    "delete from `users` where `id`=?",
+				"postgres": `delete from "users" where "id"=?`,
+				"sqlite3":  `delete from "users" where "id"=?`,
+				"mssql":    "delete from [users] where [id]=?",
+			},
+			params: []interface{}{1},
+		},
+		{
+			name: "join",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				return b.From("users u").Join("orders o", "o.user_id = u.id").Where("o.id", 1).toDeleteSql()
+			},
+			want: map[string]string{
+				"mysql":    "delete `u` from `users` as `u` join `orders` as `o` on `o`.`user_id` = `u`.`id` where `o`.`id`=?",
+				"postgres": `delete from "users" as "u" using "orders" as "o" where ("o"."user_id" = "u"."id") and ("o"."id"=?)`,
+				"mssql":    "delete [u] from [users] as [u] join [orders] as [o] on [o].[user_id] = [u].[id] where [o].[id]=?",
+			},
+			params: []interface{}{1},
+		},
+		{
+			name: "order by and limit",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				return b.From("users").Where("id", 1).OrderBy("id").Limit(5, 0).toDeleteSql()
+			},
+			want: map[string]string{
+				"mysql": "delete from `users` where `id`=? order by `id` limit 5",
+			},
+			params: []interface{}{1},
+		},
+		{
+			name: "full table",
+			build: func(d *dialect, b *builder) (string, []interface{}, error) {
+				return b.From("users").toDeleteSql()
+			},
+			want: map[string]string{},
+		},
+	})
+}
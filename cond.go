@@ -0,0 +1,229 @@
+package tinysql
+
+import (
+	"strings"
+)
+
+// Cond 条件集合,用于where及join的on条件
+type Cond struct {
+	d          *dialect
+	conditions []whereConstraint
+	groupStart int
+	groupEnd   int
+	err        error
+}
+
+// newCond 创建一个条件集合
+func newCond(d *dialect) Cond {
+	return Cond{d: d, conditions: make([]whereConstraint, 0, 0)}
+}
+
+// Where 添加列与值比较的条件,key中可以包含比较符,如 o.amount>=
+func (this *Cond) Where(key string, val interface{}) *Cond {
+	return this.where(key, val, "", "and")
+}
+
+// OrWhere 以or连接列与值比较的条件
+func (this *Cond) OrWhere(key string, val interface{}) *Cond {
+	return this.where(key, val, "", "or")
+}
+
+// WhereIn 添加列与多个值比较的条件
+func (this *Cond) WhereIn(key string, val []interface{}) *Cond {
+	return this.whereIn(key, val, "and")
+}
+
+// OrWhereIn 以or连接列与多个值比较的条件
+func (this *Cond) OrWhereIn(key string, val []interface{}) *Cond {
+	return this.whereIn(key, val, "or")
+}
+
+// On 添加列与列比较的条件,key中可以包含比较符,如 On("o.user_id", "u.id")
+func (this *Cond) On(key string, column string) *Cond {
+	return this.on(key, column, "and")
+}
+
+// OrOn 以or连接列与列比较的条件
+func (this *Cond) OrOn(key string, column string) *Cond {
+	return this.on(key, column, "or")
+}
+
+// WhereJSON 添加json列中指定路径的值与val比较的条件,路径的各级使用->分隔,key中可以包含比较符
+//  如 WhereJSON("settings->theme", "dark"),WhereJSON("settings->limits->0>=", 10)
+//  根据val的类型按字符串,数字或布尔值比较,支持mysql,postgres及sqlite3
+func (this *Cond) WhereJSON(key string, val interface{}) *Cond {
+	return this.whereJSON(key, val, "and")
+}
+
+// OrWhereJSON 以or连接json路径的条件
+func (this *Cond) OrWhereJSON(key string, val interface{}) *Cond {
+	return this.whereJSON(key, val, "or")
+}
+
+// GroupStart 下一个条件前添加左括号
+func (this *Cond) GroupStart() *Cond {
+	this.groupStart++
+	return this
+}
+
+// GroupEnd 下一个条件后添加右括号
+func (this *Cond) GroupEnd() *Cond {
+	this.groupEnd++
+	return this
+}
+
+// setError 记录第一个错误
+func (this *Cond) setError(err error) {
+	if this.err == nil {
+		this.err = err
+	}
+}
+
+func (this *Cond) on(key string, column string, t string) *Cond {
+	var c, err = parseExpr(this.d, column, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	return this.where(key, nil, c, t)
+}
+
+// where 添加条件
+//  operand:不为空时替代?占位符输出,用于列与列比较
+func (this *Cond) where(key string, val interface{}, operand string, t string) *Cond {
+	var keyName, symbol = key, "="
+	if p := strings.IndexAny(key, "<=>!"); p >= 0 {
+		keyName = key[:p]
+		symbol = strings.Trim(key[p:], " ")
+	}
+	if !whereSymbols[symbol] {
+		this.setError(TinySqlErrorExprInvalidError.Format(key).Error())
+		return this
+	}
+	//处理限定,如database.table.column
+	var err error
+	keyName, err = parseExpr(this.d, keyName, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var aa = new(whereConstraint)
+	aa.isOr = strings.ToUpper(t) == "OR"
+	aa.multiValue = false
+	aa.value = val
+	aa.operand = operand
+	aa.column = keyName + symbol
+	this.add(aa)
+	return this
+}
+
+func (this *Cond) whereJSON(key string, val interface{}, t string) *Cond {
+	var path = strings.TrimRight(key, "<=>! ")
+	var symbol = strings.TrimSpace(key[len(path):])
+	if symbol == "" {
+		symbol = "="
+	}
+	if !whereSymbols[symbol] {
+		this.setError(TinySqlErrorExprInvalidError.Format(key).Error())
+		return this
+	}
+	var keys = strings.Split(path, "->")
+	var column, err = parseExpr(this.d, keys[0], exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	for i := 1; i < len(keys); i++ {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+	var expr string
+	expr, val, err = this.d.jsonPath(column, keys[1:], val)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var aa = new(whereConstraint)
+	aa.isOr = strings.ToUpper(t) == "OR"
+	aa.value = val
+	aa.column = expr + symbol
+	this.add(aa)
+	return this
+}
+
+func (this *Cond) whereIn(key string, val []interface{}, t string) *Cond {
+	//处理限定,如database.table.column
+	var err error
+	key, err = parseExpr(this.d, key, exprColumn)
+	if err != nil {
+		this.setError(err)
+		return this
+	}
+	var aa = new(whereConstraint)
+	aa.isOr = strings.ToUpper(t) == "OR"
+	aa.multiValue = true
+	aa.values = val
+	aa.column = key
+	this.add(aa)
+	return this
+}
+
+// add 添加条件,并应用尚未使用的括号
+func (this *Cond) add(aa *whereConstraint) {
+	if this.groupStart != 0 {
+		aa.extCharPosition = 1
+		aa.extChar = this.groupStart
+		this.groupStart = 0
+	} else if this.groupEnd != 0 {
+		aa.extCharPosition = 2
+		aa.extChar = this.groupEnd
+		this.groupEnd = 0
+	} else {
+		aa.extCharPosition = 0
+	}
+	this.conditions = append(this.conditions, *aa)
+}
+
+// empty 是否没有任何条件
+func (this *Cond) empty() bool {
+	return len(this.conditions) == 0
+}
+
+// toSql 生成条件语句
+func (this *Cond) toSql() (string, []interface{}) {
+	var sql = ""
+	var params = make([]interface{}, 0, 0)
+	for i := 0; i < len(this.conditions); i++ {
+		var v = this.conditions[i]
+		if i != 0 {
+			if v.isOr {
+				sql += " or "
+			} else {
+				sql += " and "
+			}
+		}
+		//where group
+		if v.extCharPosition == 1 {
+			sql += strings.Repeat("(", v.extChar)
+		}
+		if v.multiValue {
+			sql += (v.column + " in (")
+			sql += strings.Repeat("?,", len(v.values))
+			sql = sql[:len(sql)-1]
+			sql += ")"
+			params = append(params, v.values...)
+		} else if v.operand != "" {
+			sql += v.column + v.operand
+		} else {
+			sql += (v.column + "?")
+			params = append(params, v.value)
+		}
+		// where group
+		if v.extCharPosition == 2 {
+			sql += strings.Repeat(")", v.extChar)
+		}
+	}
+	if this.groupEnd != 0 {
+		sql += strings.Repeat(")", this.groupEnd)
+	}
+	return sql, params
+}
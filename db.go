@@ -3,6 +3,7 @@ package tinysql
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 // 数据库链接
@@ -10,19 +11,25 @@ type DB struct {
 	db         *sql.DB
 	tx         *sql.Tx
 	autoCommit bool
+	dialect    *dialect
+	conn       *connection
 }
 
 func (this *DB) NewBuilder() *builder {
 	var b = new(builder)
-	b.reset()
 	b.db = this
+	b.reset()
 	return b
 }
 
 // Query 查询sql
 func (this *DB) Query(sql string, params ...interface{}) *Rows {
-	var rows, err = this.db.Query(sql, params...)
-	return &Rows{rows, err, nil}
+	if this.autoCommit {
+		var rows, err = this.db.Query(sql, params...)
+		return &Rows{rows: rows, err: err, conn: this.conn, db: this}
+	}
+	var rows, err = this.tx.Query(sql, params...)
+	return &Rows{rows: rows, err: err, conn: this.conn, db: this}
 }
 
 // Exec 执行sql
@@ -34,6 +41,38 @@ func (this *DB) Exec(sql string, params ...interface{}) (sql.Result, error) {
 	}
 }
 
+// AllowFullTable 设置该链接是否允许执行不带条件的update及delete,默认不允许
+//  对所有通过同一链接名称Open得到的DB生效,需要在使用该链接之前设置
+func (this *DB) AllowFullTable(allow bool) {
+	this.conn.allowFullTable = allow
+}
+
+// SetLocation 设置该链接解析不带时区的时间时使用的时区,默认为time.Local
+//  对所有通过同一链接名称Open得到的DB生效,需要在使用该链接之前设置
+func (this *DB) SetLocation(loc *time.Location) {
+	this.conn.location = loc
+}
+
+// SetStrict 设置该链接扫描数据时是否使用严格模式,默认不使用
+//  严格模式下结构体中没有对应列的字段,结果中没有对应字段的列,超出字段范围及丢失精度的数值都会返回错误,
+//  适合在测试中发现结构体与表结构的差异,对所有通过同一链接名称Open得到的DB生效,需要在使用该链接之前设置
+func (this *DB) SetStrict(strict bool) {
+	this.conn.strict = strict
+}
+
+// SetNaming 设置该链接中结构体名称与表名,字段名称与列名的转换规则,默认为DefaultNaming{}
+//  如 db.SetNaming(tinysql.DefaultNaming{TablePrefix: "t_", Plural: true}),对所有通过同一链接名称Open得到的DB生效,
+//  需要在使用该链接之前设置
+func (this *DB) SetNaming(naming NamingStrategy) {
+	this.conn.naming = naming
+}
+
+// SetDebug 设置该链接是否输出builder执行的sql,默认不输出
+//  对所有通过同一链接名称Open得到的DB生效,需要在使用该链接之前设置
+func (this *DB) SetDebug(debug bool) {
+	this.conn.debug = debug
+}
+
 // Begin 开始事务
 func (this *DB) begin() bool {
 	var err error
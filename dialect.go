@@ -0,0 +1,252 @@
+package tinysql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 占位符类型
+const (
+	bindQuestion = iota // ?
+	bindDollar          // $1,$2
+	bindAt              // @p1,@p2
+)
+
+// update及delete中join的语法
+const (
+	writeJoinInline = iota // update t join j ... set,delete t from t join j
+	writeJoinUsing         // update t set ... from j,delete from t using j
+	writeJoinTarget        // update t set ... from t join j,delete t from t join j
+)
+
+// 数据库方言,描述不同数据库之间sql语法的差异
+type dialect struct {
+	name          string
+	quoteStart    byte
+	quoteEnd      byte
+	bindVar       int
+	fullJoin      bool   // 是否支持full join
+	joinUsing     bool   // 是否支持join using
+	intersect     bool   // 是否支持intersect及except
+	bareUnion     bool   // union的各个查询是否不能使用括号包裹
+	recursive     string // 递归公用表表达式的关键字
+	namedWindow   bool   // 是否支持命名窗口(window子句)
+	locking       bool   // 是否支持for update等行锁语句
+	writeJoin     int    // update及delete中join的语法
+	deleteUsing   bool   // 是否支持delete ... using
+	writeLimit    bool   // 单表update及delete是否支持order by及limit
+	returning     int    // 返回被修改行的方式
+	contiguousId  bool   // 一条insert语句插入多行时生成的自增id是否连续,LastInsertId为第一行的id
+	valuesDefault bool   // insert的values中是否支持default关键字
+}
+
+var (
+	dialectMysql = &dialect{
+		name:          "mysql",
+		quoteStart:    '`',
+		quoteEnd:      '`',
+		bindVar:       bindQuestion,
+		joinUsing:     true,
+		recursive:     "recursive",
+		namedWindow:   true,
+		locking:       true,
+		writeJoin:     writeJoinInline,
+		writeLimit:    true,
+		contiguousId:  true,
+		valuesDefault: true,
+	}
+	dialectPostgres = &dialect{
+		name:          "postgres",
+		quoteStart:    '"',
+		quoteEnd:      '"',
+		bindVar:       bindDollar,
+		fullJoin:      true,
+		joinUsing:     true,
+		intersect:     true,
+		recursive:     "recursive",
+		namedWindow:   true,
+		locking:       true,
+		writeJoin:     writeJoinUsing,
+		deleteUsing:   true,
+		returning:     returningClause,
+		valuesDefault: true,
+	}
+	dialectSqlite = &dialect{
+		name:        "sqlite3",
+		quoteStart:  '"',
+		quoteEnd:    '"',
+		bindVar:     bindQuestion,
+		fullJoin:    true,
+		joinUsing:   true,
+		intersect:   true,
+		bareUnion:   true,
+		recursive:   "recursive",
+		namedWindow: true,
+		writeJoin:   writeJoinUsing,
+		returning:   returningClause,
+	}
+	dialectMssql = &dialect{
+		name:          "mssql",
+		quoteStart:    '[',
+		quoteEnd:      ']',
+		bindVar:       bindAt,
+		fullJoin:      true,
+		intersect:     true,
+		writeJoin:     writeJoinTarget,
+		returning:     returningOutput,
+		valuesDefault: true,
+	}
+)
+
+// 驱动名称与方言的对应关系
+var driverDialects = map[string]*dialect{
+	"mysql":     dialectMysql,
+	"postgres":  dialectPostgres,
+	"pgx":       dialectPostgres,
+	"sqlite3":   dialectSqlite,
+	"sqlite":    dialectSqlite,
+	"mssql":     dialectMssql,
+	"sqlserver": dialectMssql,
+}
+
+// getDialect 根据驱动名称获取方言,未知的驱动使用mysql方言
+func getDialect(driver string) *dialect {
+	var d, ok = driverDialects[driver]
+	if ok {
+		return d
+	}
+	return dialectMysql
+}
+
+// quote 为标识符添加限定符,标识符中的结束限定符会被转义
+func (this *dialect) quote(name string) string {
+	var end = string(this.quoteEnd)
+	return string(this.quoteStart) + strings.Replace(name, end, end+end, -1) + end
+}
+
+// limit 生成limit语句
+//  ordered:语句中是否已经包含order by
+func (this *dialect) limit(limit, offset int, ordered bool) string {
+	switch this {
+	case dialectPostgres, dialectSqlite:
+		var sql = " limit " + strconv.Itoa(limit)
+		if offset != 0 {
+			sql += " offset " + strconv.Itoa(offset)
+		}
+		return sql
+	case dialectMssql:
+		var sql = ""
+		if !ordered {
+			sql += " order by (select null)"
+		}
+		return sql + " offset " + strconv.Itoa(offset) + " rows fetch next " + strconv.Itoa(limit) + " rows only"
+	default:
+		return " limit " + strconv.Itoa(offset) + "," + strconv.Itoa(limit)
+	}
+}
+
+// jsonPath 生成读取json列中指定路径的值的表达式
+//  column:添加限定符后的列名
+//  keys:路径中的各级键或数组下标,只能包含字母,数字及下划线
+//  val:比较的值,决定表达式的类型
+//  return:(表达式,比较时使用的值,错误)
+func (this *dialect) jsonPath(column string, keys []string, val interface{}) (string, interface{}, error) {
+	if len(keys) == 0 {
+		return "", nil, TinySqlErrorExprInvalidError.Format(column).Error()
+	}
+	for _, k := range keys {
+		if !isJSONKey(k) {
+			return "", nil, TinySqlErrorExprInvalidError.Format(k).Error()
+		}
+	}
+	switch this {
+	case dialectPostgres:
+		var expr = "(" + column + "#>>'{" + strings.Join(keys, ",") + "}')"
+		switch val.(type) {
+		case bool:
+			return expr + "::boolean", val, nil
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return expr + "::numeric", val, nil
+		}
+		return expr, val, nil
+	case dialectMysql, dialectSqlite:
+		var path = "$"
+		for _, k := range keys {
+			if _, err := strconv.Atoi(k); err == nil {
+				path += "[" + k + "]"
+			} else {
+				path += "." + k
+			}
+		}
+		var expr = "json_extract(" + column + ",'" + path + "')"
+		if this == dialectMysql {
+			//mysql中json的字符串及布尔值需要转换为文本比较
+			switch v := val.(type) {
+			case string:
+				return "json_unquote(" + expr + ")", val, nil
+			case bool:
+				return "json_unquote(" + expr + ")", strconv.FormatBool(v), nil
+			}
+		}
+		return expr, val, nil
+	}
+	return "", nil, TinySqlErrorUnsupportedError.Format(this.name, "json path").Error()
+}
+
+// isJSONKey 判断是否为json路径中的键(字母,数字及下划线)或数组下标
+func isJSONKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if !isIdentPart(k[i]) || k[i] == '$' {
+			return false
+		}
+	}
+	return true
+}
+
+// compound 包裹组合查询(union等)中的单个查询
+func (this *dialect) compound(sql string) string {
+	if this.bareUnion {
+		return sql
+	}
+	return "(" + sql + ")"
+}
+
+// rebind 将sql中的?占位符替换为方言对应的占位符,忽略字符串及标识符中的?
+func (this *dialect) rebind(sql string) string {
+	if this.bindVar == bindQuestion {
+		return sql
+	}
+	var result = make([]byte, 0, len(sql)+8)
+	var n = 0
+	var end byte = 0
+	for i := 0; i < len(sql); i++ {
+		var c = sql[i]
+		if end != 0 {
+			if c == end {
+				end = 0
+			}
+			result = append(result, c)
+			continue
+		}
+		switch c {
+		case '\'':
+			end = '\''
+		case this.quoteStart:
+			end = this.quoteEnd
+		case '?':
+			n++
+			if this.bindVar == bindDollar {
+				result = append(result, '$')
+			} else {
+				result = append(result, '@', 'p')
+			}
+			result = strconv.AppendInt(result, int64(n), 10)
+			continue
+		}
+		result = append(result, c)
+	}
+	return string(result)
+}
@@ -10,8 +10,19 @@ type TinySqlError string
 
 // 错误码
 const (
-	TinySqlErrorParamInvalidError TinySqlError = "T10010:TinySqlErrorParamInvalidError,无效的输入类型(%s)"
-	TinySqlErrorNoRowError        TinySqlError = "T10011:TinySqlErrorNoRowError,没有发现数据(%s)"
+	TinySqlErrorParamInvalidError     TinySqlError = "T10010:TinySqlErrorParamInvalidError,无效的输入类型(%s)"
+	TinySqlErrorNoRowError            TinySqlError = "T10011:TinySqlErrorNoRowError,没有发现数据(%s)"
+	TinySqlErrorExprInvalidError      TinySqlError = "T10012:TinySqlErrorExprInvalidError,无效的表达式(%s)"
+	TinySqlErrorColumnNotAllowedError TinySqlError = "T10013:TinySqlErrorColumnNotAllowedError,不允许使用的列(%s)"
+	TinySqlErrorUnsupportedError      TinySqlError = "T10014:TinySqlErrorUnsupportedError,当前数据库(%s)不支持%s"
+	TinySqlErrorNoTransactionError    TinySqlError = "T10015:TinySqlErrorNoTransactionError,需要在事务中执行(%s)"
+	TinySqlErrorFullTableError        TinySqlError = "T10016:TinySqlErrorFullTableError,拒绝执行不带条件的%s,需要调用AllowFullTable"
+	TinySqlErrorTimeInvalidError      TinySqlError = "T10017:TinySqlErrorTimeInvalidError,无法解析的时间(%v)"
+	TinySqlErrorNoColumnError         TinySqlError = "T10018:TinySqlErrorNoColumnError,没有发现列(%s)"
+	TinySqlErrorUnmappedError         TinySqlError = "T10019:TinySqlErrorUnmappedError,没有对应的字段或列(%s)"
+	TinySqlErrorOverflowError         TinySqlError = "T10020:TinySqlErrorOverflowError,数值超出范围或丢失精度(%v -> %s)"
+	TinySqlErrorNoResultSetError      TinySqlError = "T10021:TinySqlErrorNoResultSetError,没有第%d个结果集"
+	TinySqlErrorNotMultiError         TinySqlError = "T10022:TinySqlErrorNotMultiError,需要调用Multi开启多结果集模式"
 )
 
 // Format 格式化错误信息并生成新的错误信息
@@ -0,0 +1,371 @@
+package tinysql
+
+import (
+	"strings"
+)
+
+// 表达式解析模式
+const (
+	exprColumn    = iota // 仅允许列名,如database.table.column
+	exprCondition        // 普通表达式,不允许别名和排序
+	exprSelect           // select列表达式,允许as别名
+	exprOrder            // order by表达式,允许asc/desc
+	exprValue            // 赋值表达式,允许?占位符
+)
+
+// 表达式词法单元类型
+const (
+	tokenIdent   = iota // 标识符
+	tokenQuoted         // 已被限定符包裹的标识符
+	tokenKeyword        // 关键字
+	tokenNumber         // 数字
+	tokenString         // 字符串
+	tokenSymbol         // 运算符及其他符号
+)
+
+type exprToken struct {
+	kind  int
+	value string
+}
+
+// 表达式中允许出现的关键字
+var exprKeywords = map[string]bool{
+	"as": true, "asc": true, "desc": true, "distinct": true,
+	"and": true, "or": true, "not": true, "is": true, "null": true,
+	"in": true, "like": true, "between": true,
+	"case": true, "when": true, "then": true, "else": true, "end": true,
+	"true": true, "false": true,
+	"current_timestamp": true, "current_date": true, "current_time": true,
+}
+
+// 表达式中禁止出现的关键字,只用于拒绝拼接其他语句,不是安全边界:
+// 函数名不受限制,无法阻止 if(ascii(...)),load_file(),pg_sleep() 等基于函数的注入
+var exprForbidden = map[string]bool{
+	"select": true, "union": true, "insert": true, "update": true, "delete": true,
+	"drop": true, "alter": true, "create": true, "truncate": true, "replace": true,
+	"exec": true, "execute": true, "into": true, "from": true, "where": true,
+	"grant": true, "revoke": true, "sleep": true, "benchmark": true,
+}
+
+// 标识符的开始限定符与结束限定符
+var identQuotes = map[byte]byte{'`': '`', '"': '"', '[': ']'}
+
+// 允许出现的运算符及符号
+var exprSymbols = []string{"<=", ">=", "<>", "!=", "||", "(", ")", ",", ".", "*", "+", "-", "/", "%", "=", "<", ">", "?"}
+
+// tokenizeExpr 将表达式拆分为词法单元
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var tokens = make([]exprToken, 0, 8)
+	for i := 0; i < len(s); {
+		var c = s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			var j = i + 1
+			for j < len(s) && isIdentPart(s[j]) {
+				j++
+			}
+			var word = s[i:j]
+			var lower = strings.ToLower(word)
+			if exprForbidden[lower] {
+				return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+			}
+			if exprKeywords[lower] {
+				tokens = append(tokens, exprToken{tokenKeyword, lower})
+			} else {
+				tokens = append(tokens, exprToken{tokenIdent, word})
+			}
+			i = j
+		case c >= '0' && c <= '9':
+			var j = i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokenNumber, s[i:j]})
+			i = j
+		case c == '`' || c == '"' || c == '[':
+			//限定符包裹的标识符,连续两个结束限定符为转义
+			var end = identQuotes[c]
+			var name = ""
+			var j = i + 1
+			for {
+				if j >= len(s) {
+					return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+				}
+				if s[j] == end {
+					if j+1 < len(s) && s[j+1] == end {
+						name += string(end)
+						j += 2
+						continue
+					}
+					break
+				}
+				name += string(s[j])
+				j++
+			}
+			if name == "" {
+				return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+			}
+			tokens = append(tokens, exprToken{tokenQuoted, name})
+			i = j + 1
+		case c == '\'':
+			//字符串,''为转义的单引号
+			var j = i + 1
+			for {
+				if j >= len(s) {
+					return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+				}
+				if s[j] == '\\' {
+					return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+				}
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, exprToken{tokenString, s[i : j+1]})
+			i = j + 1
+		default:
+			if strings.HasPrefix(s[i:], "--") || strings.HasPrefix(s[i:], "/*") {
+				return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+			}
+			var matched = false
+			for _, sym := range exprSymbols {
+				if strings.HasPrefix(s[i:], sym) {
+					tokens = append(tokens, exprToken{tokenSymbol, sym})
+					i += len(sym)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, TinySqlErrorExprInvalidError.Format(s).Error()
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '$'
+}
+
+// parseExpr 解析表达式,为其中的标识符添加限定符,并拒绝拼接其他语句的输入
+//  解析只保证标识符被正确限定,函数调用原样输出,因此exprColumn以外的模式不能用于外部输入
+//  d:生成sql使用的方言
+//  mode:解析模式,exprColumn,exprCondition,exprSelect,exprOrder,exprValue
+func parseExpr(d *dialect, s string, mode int) (string, error) {
+	var tokens, err = tokenizeExpr(s)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) == 0 {
+		return "", TinySqlErrorExprInvalidError.Format(s).Error()
+	}
+	var invalid = TinySqlErrorExprInvalidError.Format(s).Error()
+	var result = ""
+	var depth = 0
+	var typeDepth = 0 //函数参数中as之后的类型名所在的括号深度,如 cast(price as decimal(10,2)),类型名结束后为0
+	var prev *exprToken
+	for i := 0; i < len(tokens); i++ {
+		var t = tokens[i]
+		var text string
+		if typeDepth != 0 && depth == typeDepth && t.kind != tokenIdent && t.value != "(" {
+			//类型名只包括as之后连续的标识符及其后的参数
+			typeDepth = 0
+		}
+		switch t.kind {
+		case tokenIdent, tokenQuoted:
+			if t.kind == tokenIdent && typeDepth != 0 && depth == typeDepth {
+				//类型名,如 decimal,unsigned integer,double precision
+				text = t.value
+			} else if t.kind == tokenIdent && i+1 < len(tokens) && tokens[i+1].value == "(" {
+				//函数名
+				if mode == exprColumn {
+					return "", invalid
+				}
+				text = t.value
+			} else {
+				text = d.quote(t.value)
+			}
+		case tokenKeyword:
+			if mode == exprColumn {
+				return "", invalid
+			}
+			switch t.value {
+			case "as":
+				if depth != 0 {
+					//函数参数中的类型转换,as后必须是类型名
+					if typeDepth != 0 || i+1 >= len(tokens) || tokens[i+1].kind != tokenIdent {
+						return "", invalid
+					}
+					typeDepth = depth
+					break
+				}
+				//as后必须是最后一个标识符
+				if mode != exprSelect || i+2 != len(tokens) ||
+					(tokens[i+1].kind != tokenIdent && tokens[i+1].kind != tokenQuoted) {
+					return "", invalid
+				}
+			case "asc", "desc":
+				if mode != exprOrder || depth != 0 || i+1 != len(tokens) {
+					return "", invalid
+				}
+			}
+			text = t.value
+		case tokenNumber, tokenString:
+			if mode == exprColumn {
+				return "", invalid
+			}
+			text = t.value
+		case tokenSymbol:
+			if mode == exprColumn && t.value != "." && t.value != "*" {
+				return "", invalid
+			}
+			switch t.value {
+			case "(":
+				depth++
+			case ")":
+				depth--
+				if depth < 0 {
+					return "", invalid
+				}
+				if depth == typeDepth {
+					//类型的参数结束,如 decimal(10,2)
+					typeDepth = 0
+				}
+			case ".":
+				//.两侧必须是标识符
+				if prev == nil || (prev.kind != tokenIdent && prev.kind != tokenQuoted) || i+1 >= len(tokens) ||
+					(tokens[i+1].kind != tokenIdent && tokens[i+1].kind != tokenQuoted && tokens[i+1].value != "*") {
+					return "", invalid
+				}
+			case "*":
+				if mode == exprColumn && (prev == nil || prev.value != ".") {
+					return "", invalid
+				}
+			case ",":
+				if depth == 0 {
+					return "", invalid
+				}
+			case "?":
+				if mode != exprValue {
+					return "", invalid
+				}
+			}
+			text = t.value
+		}
+		if prev != nil && needSpace(*prev, t) {
+			result += " "
+		}
+		result += text
+		prev = &tokens[i]
+	}
+	if depth != 0 {
+		return "", invalid
+	}
+	return result, nil
+}
+
+// countPlaceholders 统计表达式中?占位符的数量,不包括字符串及标识符中的?
+func countPlaceholders(s string) int {
+	var tokens, _ = tokenizeExpr(s)
+	var n = 0
+	for _, t := range tokens {
+		if t.kind == tokenSymbol && t.value == "?" {
+			n++
+		}
+	}
+	return n
+}
+
+// needSpace 判断两个词法单元之间是否需要空格
+func needSpace(prev, cur exprToken) bool {
+	if prev.value == "." || prev.value == "(" || cur.value == "." || cur.value == ")" || cur.value == "," {
+		return false
+	}
+	if cur.value == "(" && prev.kind == tokenIdent {
+		return false
+	}
+	return true
+}
+
+// splitExpr 按顶层的逗号拆分表达式,忽略括号及字符串中的逗号
+func splitExpr(s string) []string {
+	var result = make([]string, 0, 4)
+	var depth = 0
+	var quote byte = 0
+	var start = 0
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'':
+			quote = c
+		case '`', '"', '[':
+			quote = identQuotes[c]
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, s[start:])
+}
+
+// parseTable 解析表名,支持database.table形式及as别名,如 users u,db.users as u
+func parseTable(d *dialect, s string) (tableModel, error) {
+	var tokens, err = tokenizeExpr(s)
+	if err != nil {
+		return tableModel{}, err
+	}
+	var invalid = TinySqlErrorExprInvalidError.Format(s).Error()
+	var isIdent = func(i int) bool {
+		return i < len(tokens) && (tokens[i].kind == tokenIdent || tokens[i].kind == tokenQuoted)
+	}
+	if !isIdent(0) {
+		return tableModel{}, invalid
+	}
+	var name = tokens[0].value
+	var result = d.quote(name)
+	var i = 1
+	for ; i+1 < len(tokens) && tokens[i].value == "." && isIdent(i+1); i += 2 {
+		name = tokens[i+1].value
+		result += "." + d.quote(name)
+	}
+	if i < len(tokens) && tokens[i].kind == tokenKeyword && tokens[i].value == "as" {
+		i++
+		if !isIdent(i) {
+			return tableModel{}, invalid
+		}
+	}
+	var ref = result
+	if isIdent(i) {
+		ref = d.quote(tokens[i].value)
+		result += " as " + ref
+		i++
+	}
+	if i != len(tokens) {
+		return tableModel{}, invalid
+	}
+	return tableModel{sql: result, ref: ref, name: name}, nil
+}
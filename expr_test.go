@@ -0,0 +1,154 @@
+package tinysql
+
+import (
+	"strings"
+	"testing"
+)
+
+var testDialects = []*dialect{dialectMysql, dialectPostgres, dialectSqlite, dialectMssql}
+
+// 表达式的种子输入,包括常见的注入尝试
+var exprSeeds = []string{
+	"name",
+	"u.name",
+	"db.users.name",
+	"`na``me`",
+	"\"na\"\"me\"",
+	"[na]]me]",
+	"count(distinct user_id) as n",
+	"cast(price as decimal(10,2)) as p",
+	"name desc",
+	"balance - ?",
+	"status = 'a''b'",
+	"name; drop table users",
+	"name -- comment",
+	"name /* comment */",
+	"`a`; select 1",
+	"\"a\\\"; select 1",
+	"[a]; drop table t",
+	"'a\\'; select 1 --'",
+	"a`b",
+	"sleep(10)",
+}
+
+// quoteEnd 返回从start开始的限定符或字符串的结束位置,连续两个结束符为转义,没有结束时返回-1
+func quoteEnd(sql string, start int, end byte) int {
+	for j := start + 1; j < len(sql); j++ {
+		if sql[j] != end {
+			continue
+		}
+		if j+1 < len(sql) && sql[j+1] == end {
+			j++
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// checkQuoting 检查sql中的限定符及字符串是否配对,且限定符及字符串之外没有;,--及/*
+func checkQuoting(d *dialect, sql string) string {
+	for i := 0; i < len(sql); i++ {
+		var c = sql[i]
+		switch {
+		case c == d.quoteStart:
+			i = quoteEnd(sql, i, d.quoteEnd)
+		case c == '\'':
+			var j = quoteEnd(sql, i, '\'')
+			if j >= 0 && strings.IndexByte(sql[i:j], '\\') >= 0 {
+				//mysql中字符串内的\为转义符
+				return "backslash in string"
+			}
+			i = j
+		case c == ';':
+			return "semicolon outside quotes"
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			return "comment outside quotes"
+		case strings.IndexByte("`\"[]\\", c) >= 0:
+			return "stray quote " + string(c)
+		}
+		if i < 0 {
+			return "unterminated quote"
+		}
+	}
+	return ""
+}
+
+func TestParseExprCast(t *testing.T) {
+	var cases = map[string]string{
+		"cast(price as decimal(10,2)) as p":   "cast(`price` as decimal(10, 2)) as `p`",
+		"cast(n as unsigned integer) + m":     "cast(`n` as unsigned integer) + `m`",
+		"if(a as b, c, d)":                    "if(`a` as b, `c`, `d`)",
+		"coalesce(cast(a as char(10)), b, c)": "coalesce(cast(`a` as char(10)), `b`, `c`)",
+		"concat(cast(a as char) , b)":         "concat(cast(`a` as char), `b`)",
+	}
+	for s, want := range cases {
+		var sql, err = parseExpr(dialectMysql, s, exprSelect)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if sql != want {
+			t.Errorf("%q:\n got %q\nwant %q", s, sql, want)
+		}
+	}
+}
+
+func FuzzParseExpr(f *testing.F) {
+	for _, s := range exprSeeds {
+		for mode := exprColumn; mode <= exprValue; mode++ {
+			f.Add(s, uint8(mode))
+		}
+	}
+	f.Fuzz(func(t *testing.T, s string, mode uint8) {
+		var m = int(mode) % (exprValue + 1)
+		for _, d := range testDialects {
+			var sql, err = parseExpr(d, s, m)
+			if err != nil {
+				continue
+			}
+			if msg := checkQuoting(d, sql); msg != "" {
+				t.Fatalf("%s mode %d: %q -> %q: %s", d.name, m, s, sql, msg)
+			}
+		}
+	})
+}
+
+func FuzzParseTable(f *testing.F) {
+	for _, s := range exprSeeds {
+		f.Add(s)
+	}
+	f.Add("users u")
+	f.Add("db.users as u")
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, d := range testDialects {
+			var table, err = parseTable(d, s)
+			if err != nil {
+				continue
+			}
+			for _, sql := range []string{table.sql, table.ref} {
+				if msg := checkQuoting(d, sql); msg != "" {
+					t.Fatalf("%s: %q -> %q: %s", d.name, s, sql, msg)
+				}
+			}
+		}
+	})
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, s := range exprSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, d := range testDialects {
+			var sql = d.quote(s)
+			if msg := checkQuoting(d, sql); msg != "" {
+				t.Fatalf("%s: %q -> %q: %s", d.name, s, sql, msg)
+			}
+			//整个结果必须是一个标识符
+			if sql[0] != d.quoteStart || quoteEnd(sql, 0, d.quoteEnd) != len(sql)-1 {
+				t.Fatalf("%s: %q -> %q: not a single identifier", d.name, s, sql)
+			}
+		}
+	})
+}
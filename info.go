@@ -2,3 +2,14 @@ package tinysql
 
 // 默认最大空闲连接数
 const DefaultMaxIdleConns = 20
+
+// 解析字符串类型的时间时依次尝试的格式,输入中秒之后的小数部分总是可以被解析
+//  不带时区的时间使用DB.SetLocation设置的时区,默认为time.Local
+var TimeLayouts = []string{
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
@@ -0,0 +1,355 @@
+package tinysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// 软删除的删除时间列
+type softDelete struct {
+	column string       //列名
+	typ    reflect.Type //字段类型,决定写入的删除时间的类型
+}
+
+// RegisterModel 为该链接注册表对应的结构体,结构体中标记为softDelete或列名为deleted_at的字段作为软删除的列,
+// 对该表执行Delete时设置删除时间,查询,更新及删除时自动排除删除时间不为null的行,使用WithTrashed取消
+//  table:表名,不包含数据库名
+//  model:结构体或结构体指针,删除时间字段支持time.Time,*time.Time及整数(unix时间戳,秒)
+//  列名在执行时按链接的命名规则解析,对所有通过同一链接名称Open得到的DB生效
+func (this *DB) RegisterModel(table string, model interface{}) error {
+	var value = reflect.Indirect(reflect.ValueOf(model))
+	if value.Kind() != reflect.Struct {
+		return TinySqlErrorParamInvalidError.Format(value.Type().String()).Error()
+	}
+	var t = value.Type()
+	var s, ok = softDeleteColumn(t, this.conn.namer())
+	if ok {
+		if _, valid := timeValue(s.typ, time.Now()); !valid {
+			return TinySqlErrorParamInvalidError.Format(s.typ.String()).Error()
+		}
+	}
+	this.conn.mu.Lock()
+	defer this.conn.mu.Unlock()
+	if !ok {
+		delete(this.conn.softDeletes, table)
+		return nil
+	}
+	if this.conn.softDeletes == nil {
+		this.conn.softDeletes = make(map[string]reflect.Type)
+	}
+	this.conn.softDeletes[table] = t
+	return nil
+}
+
+// softDeleteColumn 按命名规则查找结构体类型中标记为softDelete或列名为deleted_at的字段
+func softDeleteColumn(t reflect.Type, naming NamingStrategy) (softDelete, bool) {
+	for _, f := range structFields(reflect.New(t).Elem(), naming) {
+		if f.has("softDelete") || f.name == "deleted_at" {
+			return softDelete{column: f.name, typ: f.value.Type()}, true
+		}
+	}
+	return softDelete{}, false
+}
+
+// 结构体字段及其标签选项
+//  db标签中支持的选项:
+//  pk:主键,为零值时insert不写入,由数据库生成;auto:由数据库生成(如自增id),为零值时insert不写入,SetModel不更新;
+//  omitempty:为零值时insert及SetModel都不写入;default:为零值时insert不写入,使用数据库的默认值;
+//  readonly:insert及SetModel都不写入;
+//  autoCreateTime:为零值时insert写入当前时间,SetModel不更新;autoUpdateTime:为零值时insert写入当前时间,SetModel总是写入当前时间;
+//  softDelete:软删除的列,见DB.RegisterModel;
+//  json:写入时序列化为json字符串,读取时反序列化,nil写入为NULL
+//  时间字段支持time.Time,*time.Time及整数(unix时间戳,秒)
+type fieldModel struct {
+	name    string
+	value   reflect.Value
+	options map[string]string
+}
+
+// param 返回写入数据库时使用的参数,只有指针实现了driver.Valuer时使用字段的指针
+func (this fieldModel) param() (interface{}, error) {
+	if this.has("json") {
+		if isNil(this.value) {
+			return nil, nil
+		}
+		var data, err = json.Marshal(this.value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	var t = this.value.Type()
+	if !t.Implements(valuerType) && reflect.PtrTo(t).Implements(valuerType) && this.value.CanAddr() {
+		return this.value.Addr().Interface(), nil
+	}
+	return this.value.Interface(), nil
+}
+
+// has 字段是否带有指定的选项
+func (this fieldModel) has(option string) bool {
+	var _, ok = this.options[option]
+	return ok
+}
+
+// omitInsert insert时是否不写入该字段
+func (this fieldModel) omitInsert() bool {
+	if this.has("readonly") {
+		return true
+	}
+	return (this.has("pk") || this.has("auto") || this.has("omitempty") || this.has("default")) && isZero(this.value)
+}
+
+// omitUpdate SetModel时是否不写入该字段
+func (this fieldModel) omitUpdate() bool {
+	if this.has("readonly") || this.has("auto") || this.has("autoCreateTime") {
+		return true
+	}
+	return this.has("omitempty") && isZero(this.value)
+}
+
+// touchFields 为标记为autoCreateTime及autoUpdateTime的字段设置当前时间,可以设置时同时修改结构体
+//  insert:是否为insert,insert只设置为零值的字段,update只设置autoUpdateTime的字段
+func touchFields(fields []fieldModel, now time.Time, insert bool) {
+	for i := 0; i < len(fields); i++ {
+		var f = fields[i]
+		if insert {
+			if !(f.has("autoCreateTime") || f.has("autoUpdateTime")) || !isZero(f.value) {
+				continue
+			}
+		} else if !f.has("autoUpdateTime") {
+			continue
+		}
+		var v, ok = timeValue(f.value.Type(), now)
+		if !ok {
+			continue
+		}
+		if f.value.CanSet() {
+			f.value.Set(v)
+		}
+		fields[i].value = v
+	}
+}
+
+// timeValue 将时间转换为字段类型的值
+func timeValue(t reflect.Type, now time.Time) (reflect.Value, bool) {
+	switch {
+	case t == reflect.TypeOf(now):
+		return reflect.ValueOf(now), true
+	case t == reflect.TypeOf(&now):
+		return reflect.ValueOf(&now), true
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		var v = reflect.New(t).Elem()
+		setId(v, now.Unix())
+		return v, true
+	}
+	return reflect.Value{}, false
+}
+
+// structFields 按定义顺序列出结构体所有字段(包括通过组合得来的字段),忽略标记为-的字段
+//  同名的字段使用后出现的值,位置以先出现的为准
+func structFields(value reflect.Value, naming NamingStrategy) []fieldModel {
+	var fields = make([]fieldModel, 0, 8)
+	var index = make(map[string]int)
+	appendStructFields(value, naming, &fields, index)
+	return fields
+}
+
+func appendStructFields(value reflect.Value, naming NamingStrategy, fields *[]fieldModel, index map[string]int) {
+	if value.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < value.NumField(); i++ {
+		var fieldValue = value.Field(i)
+		var fieldType = value.Type().Field(i)
+		if fieldType.Anonymous {
+			//匿名组合字段,进行递归解析,未导出的组合类型中导出的字段同样可以访问
+			appendStructFields(embedded(fieldValue), naming, fields, index)
+			continue
+		}
+		if !fieldValue.CanInterface() {
+			continue
+		}
+		var name, options = parseTag(fieldType.Tag.Get("db"))
+		if name == "-" || isRelation(fieldType) {
+			continue
+		}
+		if _, ok := options["json"]; !ok && isNestedStruct(fieldType.Type) {
+			//嵌套的结构体来自其他表,不写入
+			continue
+		}
+		if name == "" {
+			name = naming.ColumnName(fieldType.Name)
+		}
+		var field = fieldModel{name, fieldValue, options}
+		if p, ok := index[name]; ok {
+			(*fields)[p] = field
+			continue
+		}
+		index[name] = len(*fields)
+		*fields = append(*fields, field)
+	}
+}
+
+// modelColumns 按定义顺序列出读取结构体时使用的列(包括通过组合得来的字段),不包括嵌套的结构体
+func modelColumns(t reflect.Type, naming NamingStrategy) []string {
+	var columns = make([]string, 0, 8)
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+		if field.Anonymous {
+			var ft = field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if isNestedStruct(ft) {
+				columns = append(columns, modelColumns(ft, naming)...)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		var name, options = columnTag(field)
+		if name == "-" || isRelation(field) {
+			continue
+		}
+		if _, ok := options["json"]; !ok && isNestedStruct(field.Type) {
+			continue
+		}
+		if name == "" {
+			name = naming.ColumnName(field.Name)
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+// isRelation 字段是否为通过rel标签声明的关联,关联字段不对应任何列,由Preload加载
+func isRelation(field reflect.StructField) bool {
+	return field.Tag.Get("rel") != ""
+}
+
+// columnTag 读取数据时字段对应的列名及选项,列名优先使用col标签,其次为db标签,选项来自db标签
+func columnTag(field reflect.StructField) (string, map[string]string) {
+	var name, options = parseTag(field.Tag.Get("db"))
+	if col := field.Tag.Get("col"); col != "" {
+		name = col
+	}
+	return name, options
+}
+
+// isNestedStruct 类型是否为嵌套的结构体或其指针,即按字段对应多列的结构体,
+// 不包括time.Time及实现了sql.Scanner或driver.Valuer的结构体
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	var p = reflect.PtrTo(t)
+	return !(t.Implements(scannerType) || p.Implements(scannerType) || t.Implements(valuerType) || p.Implements(valuerType))
+}
+
+// asScanner 获取值或其指针实现的sql.Scanner
+func asScanner(value reflect.Value) (sql.Scanner, bool) {
+	if value.CanAddr() && value.Addr().Type().Implements(scannerType) {
+		return value.Addr().Interface().(sql.Scanner), true
+	}
+	if value.Type().Implements(scannerType) && value.CanInterface() {
+		return value.Interface().(sql.Scanner), true
+	}
+	return nil, false
+}
+
+// pkField 查找结构体中标记为pk或auto的字段(包括通过组合得来的字段)
+//  return:(字段的反射值,列名,是否找到)
+func pkField(value reflect.Value, naming NamingStrategy) (reflect.Value, string, bool) {
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, "", false
+	}
+	for i := 0; i < value.NumField(); i++ {
+		var fieldValue = value.Field(i)
+		var fieldType = value.Type().Field(i)
+		if fieldType.Anonymous {
+			var v, name, ok = pkField(embedded(fieldValue), naming)
+			if ok {
+				return v, name, ok
+			}
+			continue
+		}
+		if !fieldValue.CanSet() {
+			continue
+		}
+		var name, options = parseTag(fieldType.Tag.Get("db"))
+		if name == "-" {
+			continue
+		}
+		if _, ok := options["pk"]; !ok {
+			if _, ok = options["auto"]; !ok {
+				continue
+			}
+		}
+		if name == "" {
+			name = naming.ColumnName(fieldType.Name)
+		}
+		return fieldValue, name, true
+	}
+	return reflect.Value{}, "", false
+}
+
+// embedded 返回匿名组合字段的结构体,字段为结构体指针时返回其指向的结构体,指针为nil时返回无效的值
+func embedded(value reflect.Value) reflect.Value {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		return value.Elem()
+	}
+	return value
+}
+
+// isNil 判断指针,map,切片及接口类型的值是否为nil
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+// isZero 判断字段是否为零值
+func isZero(value reflect.Value) bool {
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+// setId 将生成的id设置到整数类型的字段中
+func setId(value reflect.Value, id int64) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(uint64(id))
+	}
+}
+
+// idOf 读取整数类型字段的值,其他类型返回0
+func idOf(value reflect.Value) int64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint())
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package tinysql
+
+import (
+	"reflect"
+	"strings"
+)
+
+// NamingStrategy 结构体名称与表名,字段名称与列名之间的转换规则,通过DB.SetNaming为链接设置,
+// 标签中指定的列名及TableName方法返回的表名不经过转换
+type NamingStrategy interface {
+	// TableName 将结构体名称转换为表名
+	TableName(name string) string
+	// ColumnName 将字段名称转换为列名
+	ColumnName(name string) string
+}
+
+// DefaultNaming 默认的转换规则,驼峰形式转换为下划线形式,连续的大写字母视为一个单词,
+// 如 UserID 转换为 user_id,HTTPCode 转换为 http_code
+type DefaultNaming struct {
+	TablePrefix string //表名的前缀,如 t_
+	Plural      bool   //表名是否使用复数形式,如 OrderItem 转换为 order_items
+}
+
+// TableName 将结构体名称转换为表名
+func (this DefaultNaming) TableName(name string) string {
+	var table = transFieldName(name)
+	if this.Plural {
+		table = plural(table)
+	}
+	return this.TablePrefix + table
+}
+
+// ColumnName 将字段名称转换为列名
+func (this DefaultNaming) ColumnName(name string) string {
+	return transFieldName(name)
+}
+
+// 通过TableName方法指定表名的结构体,方法可以定义在结构体或其指针上
+type tableNamer interface {
+	TableName() string
+}
+
+// tableName 返回结构体类型对应的表名,结构体实现了TableName方法时使用其返回值,否则按naming转换
+func tableName(naming NamingStrategy, t reflect.Type) string {
+	if n, ok := reflect.New(t).Interface().(tableNamer); ok {
+		return n.TableName()
+	}
+	return naming.TableName(t.Name())
+}
+
+// plural 返回英文单词的复数形式,只处理常见的规则,如 category 转换为 categories,box 转换为 boxes
+func plural(word string) string {
+	var n = len(word)
+	switch {
+	case n == 0:
+		return word
+	case n > 1 && word[n-1] == 'y' && !strings.ContainsRune("aeiou", rune(word[n-2])):
+		return word[:n-1] + "ies"
+	case strings.HasSuffix(word, "s") || strings.HasSuffix(word, "x") || strings.HasSuffix(word, "z") ||
+		strings.HasSuffix(word, "ch") || strings.HasSuffix(word, "sh"):
+		return word + "es"
+	}
+	return word + "s"
+}
@@ -0,0 +1,42 @@
+package tinysql
+
+import "testing"
+
+func TestColumnName(t *testing.T) {
+	var cases = map[string]string{
+		"ID":        "id",
+		"UserID":    "user_id",
+		"HTTPCode":  "http_code",
+		"UserIDs":   "user_ids",
+		"URLs":      "urls",
+		"IsActive":  "is_active",
+		"OrderItem": "order_item",
+	}
+	for name, want := range cases {
+		if got := (DefaultNaming{}).ColumnName(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestTableName(t *testing.T) {
+	var cases = []struct {
+		naming DefaultNaming
+		name   string
+		want   string
+	}{
+		{DefaultNaming{}, "OrderItem", "order_item"},
+		{DefaultNaming{Plural: true}, "OrderItem", "order_items"},
+		{DefaultNaming{Plural: true}, "Category", "categories"},
+		{DefaultNaming{Plural: true}, "Day", "days"},
+		{DefaultNaming{Plural: true}, "Box", "boxes"},
+		{DefaultNaming{Plural: true}, "Match", "matches"},
+		{DefaultNaming{TablePrefix: "t_"}, "UserID", "t_user_id"},
+		{DefaultNaming{TablePrefix: "t_", Plural: true}, "Category", "t_categories"},
+	}
+	for _, c := range cases {
+		if got := c.naming.TableName(c.name); got != c.want {
+			t.Errorf("%+v %s: got %q, want %q", c.naming, c.name, got, c.want)
+		}
+	}
+}
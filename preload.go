@@ -0,0 +1,331 @@
+package tinysql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 关联类型
+const (
+	relHasOne     = "has_one"
+	relHasMany    = "has_many"
+	relBelongsTo  = "belongs_to"
+	relManyToMany = "many_to_many"
+)
+
+// Preload 在Rows.Scan之后加载结构体中通过rel标签声明的关联字段,每个关联只执行一次where ... in查询,
+// 多对多关联额外查询一次中间表,嵌套的关联使用.分隔,如 Preload("Items", "Items.Product")
+//  rel标签的第一项为关联类型,之后为选项:
+//  has_one,has_many:关联表的foreign列(默认为 当前结构体名_id)引用当前表的local列(默认为主键,没有主键时为id)
+//  belongs_to:当前表的foreign列(默认为 字段名_id)引用关联表的key列(默认为主键,没有主键时为id)
+//  many_to_many:中间表join的foreign列(默认为 当前结构体名_id)引用当前表的local列,
+//  references列(默认为 关联结构体名_id)引用关联表的key列
+//  table:关联表,默认为关联结构体的TableName方法的返回值或按链接的命名规则转换后的名称
+//  Items []Item `rel:"has_many,foreign=order_id"`
+//  Tags []*Tag `rel:"many_to_many,join=order_tags,foreign=order_id,references=tag_id"`
+func (this *builder) Preload(fields ...string) *builder {
+	this.preloads = append(this.preloads, fields...)
+	return this
+}
+
+// 关联的定义
+type relation struct {
+	kind       string
+	field      reflect.StructField
+	target     reflect.Type //关联的结构体类型
+	table      string
+	foreign    string
+	references string
+	local      string
+	key        string
+	join       string
+	naming     NamingStrategy
+}
+
+// newRelation 解析结构体类型t中名为name的关联字段
+func newRelation(t reflect.Type, name string, naming NamingStrategy) (*relation, error) {
+	var invalid = TinySqlErrorParamInvalidError.Format(t.String() + "." + name).Error()
+	var field, ok = t.FieldByName(name)
+	if !ok || !isRelation(field) {
+		return nil, invalid
+	}
+	var kind, options = parseTag(field.Tag.Get("rel"))
+	var target = field.Type
+	switch kind {
+	case relHasMany, relManyToMany:
+		if target.Kind() != reflect.Slice {
+			return nil, invalid
+		}
+		target = target.Elem()
+	case relHasOne, relBelongsTo:
+	default:
+		return nil, invalid
+	}
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if target.Kind() != reflect.Struct {
+		return nil, invalid
+	}
+	var r = &relation{kind: kind, field: field, target: target, naming: naming}
+	r.table = option(options, "table", tableName(naming, target))
+	r.local = option(options, "local", pkName(t, naming))
+	r.key = option(options, "key", pkName(target, naming))
+	if kind == relBelongsTo {
+		r.foreign = option(options, "foreign", naming.ColumnName(field.Name)+"_id")
+	} else {
+		r.foreign = option(options, "foreign", naming.ColumnName(t.Name())+"_id")
+	}
+	r.references = option(options, "references", naming.ColumnName(target.Name())+"_id")
+	r.join = options["join"]
+	if kind == relManyToMany && r.join == "" {
+		return nil, invalid
+	}
+	return r, nil
+}
+
+// option 读取标签中的选项,不存在时返回def
+func option(options map[string]string, name string, def string) string {
+	if v, ok := options[name]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// pkName 返回结构体类型的主键列名,没有标记主键时为id
+func pkName(t reflect.Type, naming NamingStrategy) string {
+	if _, name, ok := pkField(reflect.New(t).Elem(), naming); ok {
+		return name
+	}
+	return "id"
+}
+
+// load 查询关联的数据并设置到parents的关联字段中
+func (this *relation) load(db *DB, parents []reflect.Value) error {
+	switch this.kind {
+	case relBelongsTo:
+		var targets, err = this.find(db, this.key, columnKeys(parents, this.foreign, this.naming))
+		if err != nil {
+			return err
+		}
+		var index = groupBy(targets, this.key, this.naming)
+		for _, p := range parents {
+			var k, _ = keyOf(columnValue(p, this.foreign, this.naming))
+			this.set(p, index[k])
+		}
+	case relHasOne, relHasMany:
+		var children, err = this.find(db, this.foreign, columnKeys(parents, this.local, this.naming))
+		if err != nil {
+			return err
+		}
+		var index = groupBy(children, this.foreign, this.naming)
+		for _, p := range parents {
+			var k, _ = keyOf(columnValue(p, this.local, this.naming))
+			this.set(p, index[k])
+		}
+	case relManyToMany:
+		var keys = columnKeys(parents, this.local, this.naming)
+		if len(keys) == 0 {
+			return nil
+		}
+		//中间表中的 (foreign, references)
+		var pairs [][]interface{}
+		var _, err = db.NewBuilder().From(this.join).Select(this.foreign+","+this.references).
+			WhereIn(this.foreign, keys).Query().Scan(&pairs)
+		if err != nil {
+			return err
+		}
+		var refs = make([]interface{}, 0, len(pairs))
+		var seen = make(map[string]bool, len(pairs))
+		for _, pair := range pairs {
+			if k, ok := keyOf(pair[1]); ok && !seen[k] {
+				seen[k] = true
+				refs = append(refs, pair[1])
+			}
+		}
+		var targets []reflect.Value
+		targets, err = this.find(db, this.key, refs)
+		if err != nil {
+			return err
+		}
+		var index = groupBy(targets, this.key, this.naming)
+		var linked = make(map[string][]reflect.Value, len(keys))
+		for _, pair := range pairs {
+			var from, _ = keyOf(pair[0])
+			var to, _ = keyOf(pair[1])
+			linked[from] = append(linked[from], index[to]...)
+		}
+		for _, p := range parents {
+			var k, _ = keyOf(columnValue(p, this.local, this.naming))
+			this.set(p, linked[k])
+		}
+	}
+	return nil
+}
+
+// find 查询关联表中column的值在keys中的行
+func (this *relation) find(db *DB, column string, keys []interface{}) ([]reflect.Value, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	var result = reflect.New(reflect.SliceOf(this.target))
+	var _, err = db.NewBuilder().From(this.table).WhereIn(column, keys).Query().Scan(result.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return structValues(result.Elem()), nil
+}
+
+// set 将关联的数据设置到parent的关联字段中,has_many及many_to_many没有数据时设置为空切片
+func (this *relation) set(parent reflect.Value, values []reflect.Value) {
+	var field = parent.FieldByIndex(this.field.Index)
+	if field.Kind() == reflect.Slice {
+		var slice = reflect.MakeSlice(field.Type(), 0, len(values))
+		for _, v := range values {
+			slice = reflect.Append(slice, asType(v, field.Type().Elem()))
+		}
+		field.Set(slice)
+		return
+	}
+	if len(values) != 0 {
+		field.Set(asType(values[0], field.Type()))
+	}
+}
+
+// asType 将结构体转换为t类型,t为结构体指针时返回其地址
+func asType(value reflect.Value, t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return value.Addr()
+	}
+	return value
+}
+
+// preload 为value(结构体,结构体指针或其切片)加载paths中的关联
+func preload(db *DB, value reflect.Value, paths []string) error {
+	return preloadValues(db, structValues(value), paths)
+}
+
+func preloadValues(db *DB, parents []reflect.Value, paths []string) error {
+	if len(parents) == 0 {
+		return nil
+	}
+	//按第一级分组,保持出现的顺序
+	var names = make([]string, 0, len(paths))
+	var nested = make(map[string][]string, len(paths))
+	for _, p := range paths {
+		var name, rest = p, ""
+		if i := strings.Index(p, "."); i >= 0 {
+			name, rest = p[:i], p[i+1:]
+		}
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = nil
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+	for _, name := range names {
+		var r, err = newRelation(parents[0].Type(), name, db.conn.namer())
+		if err != nil {
+			return err
+		}
+		err = r.load(db, parents)
+		if err != nil {
+			return err
+		}
+		if len(nested[name]) == 0 {
+			continue
+		}
+		var children = make([]reflect.Value, 0, len(parents))
+		for _, p := range parents {
+			children = append(children, structValues(p.FieldByIndex(r.field.Index))...)
+		}
+		err = preloadValues(db, children, nested[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structValues 列出value中的结构体,value可以是结构体,结构体指针及其切片,忽略nil
+func structValues(value reflect.Value) []reflect.Value {
+	var values = make([]reflect.Value, 0, 8)
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			values = append(values, structValues(value.Elem())...)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, structValues(value.Index(i))...)
+		}
+	case reflect.Struct:
+		values = append(values, value)
+	}
+	return values
+}
+
+// columnValue 返回结构体中列对应字段的值,没有对应字段时返回nil
+func columnValue(value reflect.Value, column string, naming NamingStrategy) interface{} {
+	for _, f := range structFields(value, naming) {
+		if f.name == column {
+			return f.value.Interface()
+		}
+	}
+	return nil
+}
+
+// columnKeys 返回values中列的值,去除重复的值及NULL
+func columnKeys(values []reflect.Value, column string, naming NamingStrategy) []interface{} {
+	var keys = make([]interface{}, 0, len(values))
+	var seen = make(map[string]bool, len(values))
+	for _, v := range values {
+		var c = columnValue(v, column, naming)
+		if k, ok := keyOf(c); ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, c)
+		}
+	}
+	return keys
+}
+
+// groupBy 按列的值对结构体分组
+func groupBy(values []reflect.Value, column string, naming NamingStrategy) map[string][]reflect.Value {
+	var groups = make(map[string][]reflect.Value, len(values))
+	for _, v := range values {
+		if k, ok := keyOf(columnValue(v, column, naming)); ok {
+			groups[k] = append(groups[k], v)
+		}
+	}
+	return groups
+}
+
+// keyOf 将列的值转换为用于比较的字符串,使不同的整数类型及[]byte可以匹配
+//  return:(字符串,是否不为NULL)
+func keyOf(v interface{}) (string, bool) {
+	if valuer, ok := v.(driver.Valuer); ok {
+		var dv, err = valuer.Value()
+		if err != nil {
+			return "", false
+		}
+		v = dv
+	}
+	var rv = reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return "", false
+	}
+	if b, ok := rv.Interface().([]byte); ok {
+		return string(b), true
+	}
+	return fmt.Sprint(rv.Interface()), true
+}
@@ -0,0 +1,137 @@
+package tinysql
+
+import (
+	"reflect"
+)
+
+// 返回被修改行的方式
+const (
+	returningNone   = iota // 不支持
+	returningClause        // insert/update/delete ... returning col
+	returningOutput        // mssql: output inserted.col/deleted.col
+)
+
+// 带有返回列的insert,update及delete
+type returning struct {
+	b *builder
+}
+
+// Returning 设置insert,update及delete执行后返回的列,通过返回值的Insert,Update及Delete执行,
+// 被修改的行可以通过Rows.Scan读取,mysql不支持,mssql不支持带表名的列(如 u.name)
+//  b.Where("id", 1).Set("name", "n").Returning("id", "updated_at").Update("users").Scan(&user)
+func (this *builder) Returning(cols ...string) *returning {
+	if this.db.dialect.returning == returningNone {
+		this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "returning").Error())
+		return &returning{this}
+	}
+	for _, col := range cols {
+		if col == "*" {
+			this.returning = append(this.returning, col)
+			continue
+		}
+		var c, err = parseExpr(this.db.dialect, col, exprColumn)
+		if err != nil {
+			this.setError(err)
+			return &returning{this}
+		}
+		if this.db.dialect.returning == returningOutput {
+			//output中的列以inserted或deleted限定,不能再带表名
+			if tokens, _ := tokenizeExpr(col); len(tokens) != 1 {
+				this.setError(TinySqlErrorUnsupportedError.Format(this.db.dialect.name, "returning "+col).Error())
+				return &returning{this}
+			}
+		}
+		this.returning = append(this.returning, c)
+	}
+	return &returning{this}
+}
+
+// Insert 插入数据并返回指定的列
+func (this *returning) Insert(table string, model interface{}) *Rows {
+	var b = this.b
+	if b.err != nil {
+		return b.errRows()
+	}
+	var query, params, err = b.toInsertSql(table, []reflect.Value{reflect.ValueOf(model).Elem()})
+	b.reset()
+	if err != nil {
+		return &Rows{err: err}
+	}
+	return b.query(query, params)
+}
+
+// Update 更新数据并返回指定的列
+func (this *returning) Update(table string) *Rows {
+	var b = this.b
+	if b.err == nil && len(b.set) == 0 {
+		b.setError(TinySqlErrorParamInvalidError.Format("set").Error())
+	}
+	if b.err != nil {
+		return b.errRows()
+	}
+	var t, err = parseTable(b.db.dialect, table)
+	if err != nil {
+		b.reset()
+		return &Rows{err: err}
+	}
+	var query string
+	var params []interface{}
+	query, params, err = b.toUpdateSql(t)
+	b.reset()
+	if err != nil {
+		return &Rows{err: err}
+	}
+	return b.query(query, params)
+}
+
+// Delete 删除数据并返回被删除行的指定列
+func (this *returning) Delete() *Rows {
+	var b = this.b
+	if b.err != nil {
+		return b.errRows()
+	}
+	var query, params, err = b.toDeleteSql()
+	b.reset()
+	if err != nil {
+		return &Rows{err: err}
+	}
+	return b.query(query, params)
+}
+
+// returningSql 生成returning语句
+func (this *builder) returningSql() string {
+	if len(this.returning) == 0 || this.db.dialect.returning != returningClause {
+		return ""
+	}
+	var sql = " returning "
+	for i, col := range this.returning {
+		if i != 0 {
+			sql += ","
+		}
+		sql += col
+	}
+	return sql
+}
+
+// outputSql 生成mssql的output语句
+//  prefix:inserted或deleted
+func (this *builder) outputSql(prefix string) string {
+	if len(this.returning) == 0 || this.db.dialect.returning != returningOutput {
+		return ""
+	}
+	var sql = " output "
+	for i, col := range this.returning {
+		if i != 0 {
+			sql += ","
+		}
+		sql += prefix + "." + col
+	}
+	return sql
+}
+
+// errRows 重置并返回包含构造sql时产生的错误的Rows
+func (this *builder) errRows() *Rows {
+	var err = this.err
+	this.reset()
+	return &Rows{err: err}
+}
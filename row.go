@@ -0,0 +1,113 @@
+package tinysql
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+)
+
+var rowType = reflect.TypeOf(Row{})
+
+// Row 一行数据,通过列名读取各列的值,适用于列在编译时未知的查询
+//  var rows []tinysql.Row
+//  b.From("users").Query().Scan(&rows)
+//  name, err := rows[0].GetString("name")
+type Row struct {
+	names   []string
+	types   []*sql.ColumnType
+	columns map[string]int
+	values  []interface{}
+	loc     *time.Location
+}
+
+// newRow 使用扫描得到的列创建Row
+func (this *Rows) newRow(fields []interface{}) Row {
+	var values = make([]interface{}, len(fields))
+	for i := 0; i < len(fields); i++ {
+		values[i] = *(fields[i].(*interface{}))
+	}
+	return Row{this.names, this.types, this.columns, values, this.location()}
+}
+
+// Columns 返回按顺序排列的列名
+func (this Row) Columns() []string {
+	return this.names
+}
+
+// ColumnTypes 返回列的类型信息,如数据库中的类型名称,长度及是否可以为NULL
+func (this Row) ColumnTypes() []*sql.ColumnType {
+	return this.types
+}
+
+// Values 返回按列的顺序排列的值,值为驱动返回的原始值
+func (this Row) Values() []interface{} {
+	return this.values
+}
+
+// Get 返回列的原始值,列不存在时返回错误
+func (this Row) Get(name string) (interface{}, error) {
+	var i, ok = this.columns[name]
+	if !ok {
+		return nil, TinySqlErrorNoColumnError.Format(name).Error()
+	}
+	return this.values[i], nil
+}
+
+// IsNull 列的值是否为NULL,列不存在时返回true
+func (this Row) IsNull(name string) bool {
+	var v, err = this.Get(name)
+	return err != nil || v == nil
+}
+
+// GetString 以string类型读取列的值,NULL返回空字符串
+func (this Row) GetString(name string) (string, error) {
+	var v, err = this.Get(name)
+	if err != nil {
+		return "", err
+	}
+	var s sql.NullString
+	err = s.Scan(v)
+	return s.String, err
+}
+
+// GetInt64 以int64类型读取列的值,NULL返回0
+func (this Row) GetInt64(name string) (int64, error) {
+	var v, err = this.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	var i sql.NullInt64
+	err = i.Scan(v)
+	return i.Int64, err
+}
+
+// GetFloat64 以float64类型读取列的值,NULL返回0
+func (this Row) GetFloat64(name string) (float64, error) {
+	var v, err = this.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	var f sql.NullFloat64
+	err = f.Scan(v)
+	return f.Float64, err
+}
+
+// GetBool 以bool类型读取列的值,NULL返回false
+func (this Row) GetBool(name string) (bool, error) {
+	var v, err = this.Get(name)
+	if err != nil {
+		return false, err
+	}
+	var b sql.NullBool
+	err = b.Scan(v)
+	return b.Bool, err
+}
+
+// GetTime 以time.Time类型读取列的值,解析规则与扫描到结构体时相同,NULL返回零值
+func (this Row) GetTime(name string) (time.Time, error) {
+	var v, err = this.Get(name)
+	if err != nil || v == nil {
+		return time.Time{}, err
+	}
+	return parseTime(v, this.loc)
+}
@@ -2,19 +2,53 @@ package tinysql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"reflect"
+	"strings"
 	"time"
 )
 
 // 数据行
 type Rows struct {
-	rows    *sql.Rows
-	err     error
-	columns map[string]int
+	rows     *sql.Rows
+	err      error
+	columns  map[string]int
+	conn     *connection
+	names    []string          //按顺序排列的列名
+	types    []*sql.ColumnType //列的类型信息
+	used     []bool            //严格模式下记录当前行中已被解析的列
+	db       *DB               //执行预加载查询使用的链接
+	preloads []string          //Scan之后需要预加载的关联
+	multi    bool              //多结果集模式,Scan之后不关闭Rows
+	pending  []reflect.Value   //多结果集模式下等待Close之后预加载的数据
 }
 
 // parse 解析fields值到value中
+//  value或其指针实现了sql.Scanner时交由Scan解析
 func (this *Rows) parse(value reflect.Value, index int, fields []interface{}) error {
+	if value.Kind() == reflect.Ptr {
+		//指针字段,值为NULL时设置为nil,否则分配新的值后解析,
+		//在分配的值上判断sql.Scanner,避免以nil指针调用Scan
+		if *(fields[index].(*interface{})) == nil {
+			this.use(index)
+			value.Set(reflect.Zero(value.Type()))
+			return nil
+		}
+		var p = reflect.New(value.Type().Elem())
+		var err = this.parse(p.Elem(), index, fields)
+		if err != nil {
+			return err
+		}
+		value.Set(p)
+		return nil
+	}
+	if scanner, ok := asScanner(value); ok {
+		this.use(index)
+		return scanner.Scan(*(fields[index].(*interface{})))
+	}
+	if value.Kind() != reflect.Struct || value.Type().String() == "time.Time" {
+		this.use(index)
+	}
 	switch value.Kind() {
 	case reflect.Bool:
 		var b = sql.NullBool{}
@@ -32,6 +66,9 @@ func (this *Rows) parse(value reflect.Value, index int, fields []interface{}) er
 			return err
 		}
 		if i.Valid {
+			if this.strict() && value.OverflowInt(i.Int64) {
+				return TinySqlErrorOverflowError.Format(i.Int64, value.Type().String()).Error()
+			}
 			value.SetInt(i.Int64)
 		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -41,6 +78,9 @@ func (this *Rows) parse(value reflect.Value, index int, fields []interface{}) er
 			return err
 		}
 		if i.Valid {
+			if this.strict() && (i.Int64 < 0 || value.OverflowUint(uint64(i.Int64))) {
+				return TinySqlErrorOverflowError.Format(i.Int64, value.Type().String()).Error()
+			}
 			value.SetUint(uint64(i.Int64))
 		}
 	case reflect.Float32, reflect.Float64:
@@ -50,6 +90,10 @@ func (this *Rows) parse(value reflect.Value, index int, fields []interface{}) er
 			return err
 		}
 		if f.Valid {
+			if this.strict() && (value.OverflowFloat(f.Float64) ||
+				value.Kind() == reflect.Float32 && float64(float32(f.Float64)) != f.Float64) {
+				return TinySqlErrorOverflowError.Format(f.Float64, value.Type().String()).Error()
+			}
 			value.SetFloat(f.Float64)
 		}
 	case reflect.String:
@@ -65,77 +109,283 @@ func (this *Rows) parse(value reflect.Value, index int, fields []interface{}) er
 		{
 			if value.Type().String() == "time.Time" {
 				//时间结构体解析
-				var s = sql.NullString{}
-				var err = s.Scan(*(fields[index].(*interface{})))
-				if err != nil {
-					return err
-				}
-				if s.Valid {
-					result, err := time.ParseInLocation("2006-01-02 15:04:05", s.String, time.Local)
-					if err == nil {
-						value.Set(reflect.ValueOf(result))
+				var v = *(fields[index].(*interface{}))
+				if v != nil {
+					var result, err = parseTime(v, this.location())
+					if err != nil {
+						return err
 					}
+					value.Set(reflect.ValueOf(result))
 				}
 			} else {
 				//常规结构体解析
-				for i := 0; i < value.NumField(); i++ {
-					var fieldValue = value.Field(i)
-					var fieldType = value.Type().Field(i)
-					if fieldType.Anonymous {
-						//匿名组合字段,进行递归解析
-						this.parse(fieldValue, 0, fields)
-					} else {
-						//非匿名字段
-						if fieldValue.CanSet() {
-							var fieldName = fieldType.Tag.Get("col")
-							if fieldName == "-" {
-								//如果是-,则忽略当前字段
-								continue
-							}
-							if fieldName == "" {
-								//如果为空,则使用字段名
-								fieldName = transFieldName(fieldType.Name)
-							}
-							var index, ok = this.columns[fieldName]
-							if ok {
-								this.parse(fieldValue, index, fields)
-							}
-						}
-					}
+				return this.parseStruct(value, "", fields)
+			}
+		}
+
+	}
+	return nil
+}
+
+// parseStruct 按字段解析结构体
+//  prefix:列名的前缀,用于嵌套的结构体,如 user. 或标签中设置的前缀
+func (this *Rows) parseStruct(value reflect.Value, prefix string, fields []interface{}) error {
+	for i := 0; i < value.NumField(); i++ {
+		var fieldValue = value.Field(i)
+		var fieldType = value.Type().Field(i)
+		if fieldType.Anonymous {
+			//匿名组合字段,进行递归解析,结构体指针为nil时分配新的结构体
+			if fieldValue.Kind() == reflect.Ptr {
+				if !fieldValue.CanSet() || fieldValue.Type().Elem().Kind() != reflect.Struct {
+					continue
+				}
+				if fieldValue.IsNil() {
+					fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
 				}
+				fieldValue = fieldValue.Elem()
+			}
+			if isNestedStruct(fieldValue.Type()) {
+				var err = this.parseStruct(fieldValue, prefix, fields)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		//非匿名字段
+		if !fieldValue.CanSet() {
+			continue
+		}
+		var fieldName, options = columnTag(fieldType)
+		if fieldName == "-" || isRelation(fieldType) {
+			//如果是-或关联字段,则忽略当前字段
+			continue
+		}
+		if fieldName == "" {
+			//如果为空,则使用字段名
+			fieldName = this.conn.namer().ColumnName(fieldType.Name)
+		}
+		var _, isJSON = options["json"]
+		if !isJSON && isNestedStruct(fieldType.Type) {
+			//嵌套的结构体,使用 字段列名. 或标签中设置的前缀匹配列
+			var p, ok = options["prefix"]
+			if !ok {
+				p = fieldName + "."
+			}
+			var err = this.parseNested(fieldValue, prefix+p, fields)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		var index, ok = this.columns[prefix+fieldName]
+		if ok {
+			var err error
+			if isJSON {
+				err = this.parseJSON(fieldValue, index, fields)
+			} else {
+				err = this.parse(fieldValue, index, fields)
 			}
+			if err != nil {
+				return err
+			}
+		} else if this.strict() {
+			return TinySqlErrorUnmappedError.Format(value.Type().String() + "." + fieldType.Name).Error()
 		}
+	}
+	return nil
+}
 
+// parseNested 解析嵌套的结构体,结构体指针在没有不为NULL的对应列时(如left join没有匹配的行)设置为nil
+func (this *Rows) parseNested(value reflect.Value, prefix string, fields []interface{}) error {
+	if value.Kind() != reflect.Ptr {
+		return this.parseStruct(value, prefix, fields)
+	}
+	var found = false
+	for name, i := range this.columns {
+		if strings.HasPrefix(name, prefix) {
+			this.use(i)
+			found = found || *(fields[i].(*interface{})) != nil
+		}
 	}
+	if !found {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+	var p = reflect.New(value.Type().Elem())
+	var err = this.parseStruct(p.Elem(), prefix, fields)
+	if err != nil {
+		return err
+	}
+	value.Set(p)
 	return nil
 }
 
+// parseJSON 将json字符串反序列化到value中,值为NULL时保持不变
+func (this *Rows) parseJSON(value reflect.Value, index int, fields []interface{}) error {
+	this.use(index)
+	var data []byte
+	switch v := (*(fields[index].(*interface{}))).(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return TinySqlErrorParamInvalidError.Format(reflect.TypeOf(v).String()).Error()
+	}
+	return json.Unmarshal(data, value.Addr().Interface())
+}
+
+// parseTime 解析时间,支持time.Time,TimeLayouts中格式的字符串及unix时间戳(秒)
+//  loc:不带时区的时间使用的时区
+func parseTime(v interface{}, loc *time.Location) (time.Time, error) {
+	var s string
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case int64:
+		return time.Unix(t, 0).In(loc), nil
+	case []byte:
+		s = string(t)
+	case string:
+		s = t
+	default:
+		return time.Time{}, TinySqlErrorTimeInvalidError.Format(v).Error()
+	}
+	for _, layout := range TimeLayouts {
+		var result, err = time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return result, nil
+		}
+	}
+	return time.Time{}, TinySqlErrorTimeInvalidError.Format(s).Error()
+}
+
+// strict 是否使用严格模式
+func (this *Rows) strict() bool {
+	return this.conn != nil && this.conn.strict
+}
+
+// use 严格模式下标记列已被解析
+func (this *Rows) use(index int) {
+	if this.used != nil {
+		this.used[index] = true
+	}
+}
+
+// location 返回解析不带时区的时间时使用的时区
+func (this *Rows) location() *time.Location {
+	if this.conn != nil && this.conn.location != nil {
+		return this.conn.location
+	}
+	return time.Local
+}
+
+// parseAll 将一行中的所有列解析到Row,map[string]interface{}或[]interface{}中
+//  return:(value是否为这些类型,错误)
+func (this *Rows) parseAll(value reflect.Value, fields []interface{}) (bool, error) {
+	var t = value.Type()
+	switch {
+	case t == rowType:
+		value.Set(reflect.ValueOf(this.newRow(fields)))
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.Interface:
+		//以列名为key保存所有列
+		if value.IsNil() {
+			value.Set(reflect.MakeMapWithSize(t, len(this.names)))
+		}
+		for i, name := range this.names {
+			var v = reflect.Zero(t.Elem())
+			if r := resultValue(fields[i]); r != nil {
+				v = reflect.ValueOf(r)
+			}
+			value.SetMapIndex(reflect.ValueOf(name), v)
+		}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Interface:
+		//按列的顺序保存所有列
+		var row = reflect.MakeSlice(t, len(fields), len(fields))
+		for i := 0; i < len(fields); i++ {
+			var v = resultValue(fields[i])
+			if v != nil {
+				row.Index(i).Set(reflect.ValueOf(v))
+			}
+		}
+		value.Set(row)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// resultValue 返回扫描得到的列的值,[]byte转换为string,NULL为nil
+func resultValue(field interface{}) interface{} {
+	var v = *(field.(*interface{}))
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
 // scan 扫描单行数据
 func (this *Rows) scan(data reflect.Value) error {
 	if this.columns == nil {
 		var columns, err = this.rows.Columns()
 		if err != nil {
-			return this.err
+			return err
 		}
+		this.types, err = this.rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		this.names = columns
 		this.columns = make(map[string]int, len(columns))
 		for i, n := range columns {
 			this.columns[n] = i
 		}
+		//user__id同样可以通过user.id匹配
+		for i, n := range columns {
+			var alias = strings.Replace(n, "__", ".", -1)
+			if _, ok := this.columns[alias]; !ok {
+				this.columns[alias] = i
+			}
+		}
 	}
-	var fields = make([]interface{}, len(this.columns))
+	var fields = make([]interface{}, len(this.names))
 	for i := 0; i < len(fields); i++ {
 		var pif interface{}
 		fields[i] = &pif
 	}
 	var err = this.rows.Scan(fields...)
-	if err == nil {
-		err = this.parse(data, 0, fields)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	ok, err = this.parseAll(data, fields)
+	if ok {
+		return err
+	}
+	if this.strict() {
+		this.used = make([]bool, len(fields))
+	}
+	err = this.parse(data, 0, fields)
+	if err != nil || this.used == nil {
+		return err
 	}
-	return err
+	for i, used := range this.used {
+		if !used {
+			return TinySqlErrorUnmappedError.Format(this.names[i]).Error()
+		}
+	}
+	return nil
 }
 
-// Scan 扫描数据行
-//  data:将数据行中的数据解析到data中,data可以是 基础类型,time.Time类型,结构体,数组类型 的指针
+// Scan 扫描当前结果集中的数据行
+//  data:将数据行中的数据解析到data中,data可以是 基础类型,time.Time类型,结构体,Row,
+//  map[string]interface{} 及其数组类型 的指针,
+//  *[]interface{}按列的顺序读取一行中的各列,读取多行时使用*[][]interface{},
+//  map及[]interface{}中[]byte类型的值会转换为string
+//  扫描后关闭Rows并执行预加载,通过Multi开启多结果集模式时保留Rows,预加载在Close之后执行
 //  return:(扫描的行数,错误)
 func (this *Rows) Scan(data interface{}) (int, error) {
 	if this.err == nil {
@@ -149,16 +399,113 @@ func (this *Rows) Scan(data interface{}) (int, error) {
 			var n = d.New()
 			this.err = this.scan(n)
 			if this.err != nil {
+				this.rows.Close()
 				return 0, this.err
 			}
 			d.SetBack(n)
 		}
+		if this.multi {
+			if len(this.preloads) != 0 && d.length != 0 {
+				this.pending = append(this.pending, d.v)
+			}
+			return d.length, nil
+		}
+		//预加载在关闭之后执行,避免事务中同时存在未关闭的结果集
 		this.rows.Close()
+		if len(this.preloads) != 0 && d.length != 0 {
+			this.err = preload(this.db, d.v, this.preloads)
+			if this.err != nil {
+				return 0, this.err
+			}
+		}
 		return d.length, nil
 	}
 	return 0, this.err
 }
 
+// Multi 开启多结果集模式,用于返回多个结果集的存储过程,Scan之后不关闭Rows,读取完成后需要调用Close
+//  rows := db.Query("call orders_with_items(?)", id).Multi()
+//  defer rows.Close()
+//  rows.Scan(&orders)
+//  if rows.NextResultSet() {
+//  	rows.Scan(&items)
+//  }
+func (this *Rows) Multi() *Rows {
+	this.multi = true
+	return this
+}
+
+// NextResultSet 切换到下一个结果集,需要先通过Multi开启多结果集模式,没有下一个结果集时关闭Rows并返回false
+func (this *Rows) NextResultSet() bool {
+	if this.err != nil {
+		return false
+	}
+	if !this.multi {
+		this.err = TinySqlErrorNotMultiError.Error()
+		this.rows.Close()
+		return false
+	}
+	if !this.rows.NextResultSet() {
+		this.err = this.rows.Err()
+		return false
+	}
+	this.resetColumns()
+	return true
+}
+
+// resetColumns 清除当前结果集的列信息
+func (this *Rows) resetColumns() {
+	this.columns = nil
+	this.names = nil
+	this.types = nil
+}
+
+// ScanAll 将连续的结果集依次扫描到dests中,第一个结果集对应dests[0],以此类推,扫描后关闭Rows
+//  dests:与Scan的data相同,结果集少于dests时返回错误
+//  return:(各结果集扫描的行数,错误)
+func (this *Rows) ScanAll(dests ...interface{}) ([]int, error) {
+	this.multi = true
+	var counts = make([]int, 0, len(dests))
+	for i, dest := range dests {
+		if i != 0 && !this.NextResultSet() {
+			if this.err != nil {
+				return counts, this.err
+			}
+			return counts, TinySqlErrorNoResultSetError.Format(i + 1).Error()
+		}
+		var n, err = this.Scan(dest)
+		if err != nil {
+			this.Close()
+			return counts, err
+		}
+		counts = append(counts, n)
+	}
+	if err := this.Close(); err != nil {
+		return counts, err
+	}
+	return counts, nil
+}
+
+// Close 关闭Rows,丢弃尚未读取的数据行及结果集,之后执行多结果集模式下等待的预加载
+func (this *Rows) Close() error {
+	if this.rows == nil {
+		return nil
+	}
+	var err = this.rows.Close()
+	var pending = this.pending
+	this.pending = nil
+	if err != nil || this.err != nil {
+		return err
+	}
+	for _, v := range pending {
+		if err = preload(this.db, v, this.preloads); err != nil {
+			this.err = err
+			return err
+		}
+	}
+	return nil
+}
+
 // Error 返回数据行错误
 func (this *Rows) Error() error {
 	return this.err
@@ -182,8 +529,10 @@ func newData(v interface{}) (*data, error) {
 		//取指针指向的值
 		d.t = d.t.Elem()
 		d.v = d.v.Elem()
-		switch d.t.Kind() {
-		case reflect.Slice:
+		//[]interface{}为一行中的各列,不是多行
+		var isRow = d.t.Kind() == reflect.Slice && d.t.Elem().Kind() == reflect.Interface
+		switch {
+		case d.t.Kind() == reflect.Slice && !isRow:
 			{
 				d.slice = true
 				d.setType = d.t.Elem()
@@ -0,0 +1,42 @@
+package tinysql
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// testFields 构造单列的扫描结果
+func testFields(v interface{}) []interface{} {
+	var p interface{} = v
+	return []interface{}{&p}
+}
+
+func TestParseNullable(t *testing.T) {
+	var text = "a"
+	var cases = []struct {
+		name  string
+		value interface{} //字段的指针,字段中预先设置的值用于检查NULL是否会清除该值
+		input interface{}
+		want  interface{}
+	}{
+		{"*sql.NullString null", &[]*sql.NullString{{String: "old", Valid: true}}[0], nil, (*sql.NullString)(nil)},
+		{"*sql.NullString", new(*sql.NullString), []byte("a"), &sql.NullString{String: "a", Valid: true}},
+		{"sql.Null[int64] null", new(sql.Null[int64]), nil, sql.Null[int64]{}},
+		{"sql.Null[int64]", new(sql.Null[int64]), int64(7), sql.Null[int64]{V: 7, Valid: true}},
+		{"*string null", &[]*string{&text}[0], nil, (*string)(nil)},
+		{"*string", new(*string), []byte("a"), &text},
+	}
+	for _, c := range cases {
+		var rows = &Rows{}
+		var value = reflect.ValueOf(c.value).Elem()
+		var err = rows.parse(value, 0, testFields(c.input))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(value.Interface(), c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.name, value.Interface(), c.want)
+		}
+	}
+}
@@ -1,14 +1,52 @@
 // Package tinysql 实现了一个基本的sql工具
 package tinysql
 
-import "database/sql"
+import (
+	"database/sql"
+	"reflect"
+	"sync"
+	"time"
+)
 
 // 数据库链接
-var connections = map[string]*sql.DB{}
+var connections = map[string]*connection{}
+
+// 已注册的链接及其配置
+//  allowFullTable,location,strict,naming及debug只在启动时设置,读取时不加锁,mu只保护softDeletes
+type connection struct {
+	db             *sql.DB
+	dialect        *dialect
+	allowFullTable bool           //是否允许不带条件的update及delete
+	location       *time.Location //解析不带时区的时间时使用的时区,为nil时使用time.Local
+	strict         bool           //扫描数据时是否使用严格模式
+	naming         NamingStrategy //结构体与表及列名称的转换规则,为nil时使用DefaultNaming
+	debug          bool           //是否输出执行的sql
+	mu             sync.RWMutex
+	softDeletes    map[string]reflect.Type //使用软删除的表及其结构体类型
+}
+
+// softDelete 返回表的软删除列,列名按链接当前的命名规则解析
+func (this *connection) softDelete(table string) (softDelete, bool) {
+	this.mu.RLock()
+	var t, ok = this.softDeletes[table]
+	this.mu.RUnlock()
+	if !ok {
+		return softDelete{}, false
+	}
+	return softDeleteColumn(t, this.namer())
+}
+
+// namer 返回链接使用的命名规则
+func (this *connection) namer() NamingStrategy {
+	if this == nil || this.naming == nil {
+		return DefaultNaming{}
+	}
+	return this.naming
+}
 
 // Register 注册数据库链接
 //  name:链接名称
-//  driver:驱动名称
+//  driver:驱动名称,同时决定生成sql时使用的方言(mysql,postgres,sqlite3,mssql)
 //  conn:链接字符串
 //  idle:最大空闲连接数,可以使用tinysql.DefaultMaxIdleConns
 func RegisterDB(name, driver, conn string, idle int) error {
@@ -17,7 +55,7 @@ func RegisterDB(name, driver, conn string, idle int) error {
 		return err
 	}
 	db.SetMaxIdleConns(idle)
-	connections[name] = db
+	connections[name] = &connection{db: db, dialect: getDialect(driver)}
 	return nil
 }
 
@@ -28,9 +66,9 @@ func OpenDefault() *DB {
 
 // Open 获取指定名称的链接
 func Open(name string) *DB {
-	var db, ok = connections[name]
+	var c, ok = connections[name]
 	if ok {
-		return &DB{db, nil, true}
+		return &DB{c.db, nil, true, c.dialect, c}
 	}
 	return nil
 }
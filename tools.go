@@ -1,13 +1,57 @@
 package tinysql
 
 import (
-	"regexp"
 	"strings"
 )
 
-var reg = regexp.MustCompile(`\B[A-Z]`)
+// parseTag 解析字段标签,逗号前为列名,之后为选项,选项可以带有值
+//  如 db:"id,pk,auto" 返回 ("id", {"pk":"", "auto":""}),
+//  关联的rel标签使用相同的格式,如 rel:"has_many,foreign=order_id" 返回 ("has_many", {"foreign":"order_id"})
+func parseTag(tag string) (string, map[string]string) {
+	var parts = strings.Split(tag, ",")
+	var options = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		var kv = strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			options[kv[0]] = kv[1]
+		} else {
+			options[kv[0]] = ""
+		}
+	}
+	return strings.TrimSpace(parts[0]), options
+}
 
-// transFieldName 转换字段名称
+// transFieldName 转换字段名称,驼峰形式转换为下划线形式,连续的大写字母及其后表示复数的s视为一个单词
+//  如 UserName 转换为 user_name,UserID 转换为 user_id,UserIDs 转换为 user_ids,HTTPCode 转换为 http_code
 func transFieldName(name string) string {
-	return strings.ToLower(reg.ReplaceAllString(name, "_$0"))
+	var result = make([]byte, 0, len(name)+4)
+	for i := 0; i < len(name); i++ {
+		var c = name[i]
+		if isUpper(c) {
+			var lower = i+1 < len(name) && isLower(name[i+1])
+			if lower && name[i+1] == 's' && (i+2 == len(name) || !isLower(name[i+2])) {
+				//大写字母后单独的s表示复数
+				lower = false
+			}
+			//小写字母或数字之后,或连续大写字母中的最后一个(其后为小写字母)开始新的单词
+			if i > 0 && name[i-1] != '_' && (!isUpper(name[i-1]) || lower) {
+				result = append(result, '_')
+			}
+			c += 'a' - 'A'
+		}
+		result = append(result, c)
+	}
+	return string(result)
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
 }